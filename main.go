@@ -3,9 +3,12 @@ package main
 import (
 	"flag"
 	"fmt"
-	"github.com/solaa51/gosab/src/controller"
+	_ "github.com/solaa51/gosab/src/controller" //控制器在init中注册到router
 	"github.com/solaa51/gosab/system/core/app"
+	"github.com/solaa51/gosab/system/core/graceful"
+	"github.com/solaa51/gosab/system/core/middleware"
 	"github.com/solaa51/gosab/system/core/myContext"
+	"github.com/solaa51/gosab/system/core/router"
 	"log"
 	"net/http"
 	"net/url"
@@ -26,14 +29,11 @@ var g = flag.Bool("g", false, "平滑重启-g，必须要有服务已经运行
 
 type MyHandler struct{}
 
-//TODO 新增加的控制器 需要在此处添加处理
+//按控制器名称 从注册表中实例化控制器
+//新增加的控制器 在自身包的init中调用router.Register注册即可
 func (h *MyHandler) configClass(ctx *myContext.Context) {
-	var class interface{} //初始化一个interface 用于接收实例化的struct的地址
-
-	switch ctx.Controller {
-	case "welcome":
-		class = &controller.Welcome{Ctx: ctx}
-	default:
+	class := router.New(ctx.Controller, ctx) //接收实例化的struct的地址
+	if class == nil {
 		http.Error(ctx.Writer, "碰到了不认识的路由", http.StatusNotFound)
 		return
 	}
@@ -55,17 +55,43 @@ func (h *MyHandler) run(ctx *myContext.Context, class interface{}) {
 	methodValue := getValue.MethodByName(ctx.Method)
 	args := make([]reflect.Value, 0)
 
-	start := time.Now()
 	_ = methodValue.Call(args) //执行方法
-	//计算出执行时间 记录调用日志
-	APP.Log.Trace("run time:" + ctx.Controller + "/" + ctx.Method + "--" + time.Since(start).String())
+}
+
+//路由或[timeouts]配置了超时时 调整本次请求所在连接的读写超时 HTTP/2请求保持服务默认值
+func (h *MyHandler) deadline(r *http.Request, route *router.Route, cClass, cMethod string) {
+	var read, write time.Duration
+	if route != nil {
+		read, write = route.Timeouts()
+	}
+
+	cRead, cWrite := APP.RouteTimeout(cClass, cMethod)
+	if cRead != 0 {
+		read = cRead
+	}
+	if cWrite != 0 {
+		write = cWrite
+	}
+
+	if read != 0 || write != 0 {
+		_ = graceful.SetDeadline(r, read, write)
+	}
 }
 
 func (h *MyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rw := myContext.NewResponseWriter(w) //记录开始时间、状态码及输出大小 用于访问日志
+
+	if !h.serve(rw, r) { //中间件链中由AccessLog记录
+		middleware.LogRequest(APP, r, rw)
+	}
+}
+
+//处理请求 返回是否进入了中间件链
+func (h *MyHandler) serve(w *myContext.ResponseWriter, r *http.Request) bool {
 	//处理静态文件请求
 	if r.URL.String() == "/favicon.ico" {
 		http.ServeFile(w, r, "./favicon.ico")
-		return
+		return false
 	}
 
 	//处理配置中允许的静态文件映射
@@ -80,34 +106,53 @@ func (h *MyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			fi, err := os.Stat(ff)
 			if err != nil {
 				http.Error(w, "file not found", http.StatusNotFound)
-				return
+				return false
 			}
 
 			if !fp.Dir { //不允许遍历目录内容
 				if fi.IsDir() {
 					http.Error(w, "不允许遍历文件", http.StatusNotImplemented)
-					return
+					return false
 				}
 			}
 
 			http.ServeFile(w, r, ff)
-			return
+			return false
 		}
 	}
 
-	//动态匹配路由
-	ctx, err := myContext.NewContext(r, w, APP) //解析请求 构建上下文
+	//动态匹配路由 优先匹配路由表 未匹配时按 /控制器/方法 约定处理
+	route, cClass, cMethod, params, err := router.Resolve(r.Method, r.URL.Path)
+	switch err {
+	case nil:
+	case router.ErrMethodNotAllowed:
+		w.Header().Set("Allow", strings.Join(router.Allowed(r.URL.Path), ", "))
+		http.Error(w, err.Error(), http.StatusMethodNotAllowed)
+		return false
+	default: //已在路由表声明的方法 只能通过路由表访问
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return false
+	}
+
+	//按路由调整读写超时 需在解析请求体之前
+	h.deadline(r, route, cClass, cMethod)
+
+	ctx, err := myContext.NewRouteContext(r, w, APP, cClass, cMethod, params) //解析请求 构建上下文
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadGateway)
-		return
+		return false
 	}
-	h.configClass(ctx)
+
+	//依次执行中间件 最后执行控制器方法
+	ctx.Run(router.Handlers(ctx, route, h.configClass)...)
+
+	return true
 }
 
 func main() {
 	flag.Parse()
 
-	daemon(*d)
+	daemon(*d && !*g) //热重启的新进程沿用原进程的启动参数 已在后台运行
 
 	//http handle 处理
 	handler := MyHandler{}
@@ -121,6 +166,16 @@ func main() {
 
 func init() {
 	APP = app.NewApp("")
+
+	//内置中间件 可按需调整顺序或增加自定义中间件
+	router.Use(
+		middleware.AccessLog(),
+		middleware.Recovery(),
+		middleware.IpCheck(),
+		middleware.ClientCert(),
+		middleware.SignCheck(),
+		middleware.RateLimit(),
+	)
 }
 
 //进入守护进程
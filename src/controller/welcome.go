@@ -3,8 +3,15 @@ package controller
 import (
 	"fmt"
 	"github.com/solaa51/gosab/system/core/myContext"
+	"github.com/solaa51/gosab/system/core/router"
 )
 
+func init() {
+	router.Register("welcome", func(ctx *myContext.Context) interface{} {
+		return &Welcome{Ctx: ctx}
+	})
+}
+
 type Welcome struct {
 	Ctx *myContext.Context
 }
@@ -1,15 +1,23 @@
 package app
 
 import (
+	"crypto/tls"
+	"errors"
 	"github.com/solaa51/gosab/system/core/commonFunc"
 	"github.com/solaa51/gosab/system/core/configFileMonitor"
+	"github.com/solaa51/gosab/system/core/db"
 	"github.com/solaa51/gosab/system/core/graceful"
+	"github.com/solaa51/gosab/system/core/limiter"
 	slog "github.com/solaa51/gosab/system/core/log"
+	"github.com/solaa51/gosab/system/core/tlsConfig"
 	"log"
 	"net/http"
 	"os"
-	"path/filepath"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -19,18 +27,41 @@ import (
 type App struct {
 	Name string `toml:"name"` //应用名称
 
-	//TODO 数据库配置
+	Databases map[string]db.Config      `toml:"db"`     //数据库配置 [db.名称] 默认使用default
+	Shards    map[string]db.ShardConfig `toml:"shards"` //分库分表配置 [shards.逻辑表名]
 
-	HTTP     bool   `toml:"http"`  //是否开启http服务
-	PORT     string `toml:"PORT"`  //http 监听端口
-	HTTPS    bool   `toml:"https"` //是否开启https服务
-	HTTPSKEY string `toml:"httpsKey"`
-	HTTPSPEM string `toml:"httpsPem"`
+	HTTP          bool   `toml:"http"`      //是否开启http服务
+	PORT          string `toml:"PORT"`      //http 监听端口 也可为完整地址 如127.0.0.1:8080
+	HTTPS         bool   `toml:"https"`     //是否开启https服务
+	HttpsPort     string `toml:"httpsPort"` //https 监听端口或地址 为空时https使用PORT 且不再监听http
+	HTTPSKEY      string `toml:"httpsKey"`
+	HTTPSPEM      string `toml:"httpsPem"`
+	HttpsRedirect bool   `toml:"httpsRedirect"` //http请求跳转到https 需同时配置httpsPort
+	UnixSocket    string `toml:"unixSocket"`    //同时监听的unix socket文件路径 为空不监听
+
+	TLS        tlsConfig.Config  `toml:"tls"`        //多组证书、最低版本及加密套件 [tls] 证书文件变化时自动重新加载 修改配置需重启
+	ClientCert map[string]string `toml:"clientCert"` //按控制器的客户端证书策略 required optional off "*"为默认 需配置tls.clientCa
+
+	ReadTimeout       int64                   `toml:"readTimeout"`       //读取整个请求的最大时长 秒 默认30 -1不限制 修改后需重启
+	WriteTimeout      int64                   `toml:"writeTimeout"`      //写响应的最大时长 秒 默认30 -1不限制 修改后需重启
+	IdleTimeout       int64                   `toml:"idleTimeout"`       //keep-alive连接的最大空闲时间 秒 默认30 修改后需重启
+	ReadHeaderTimeout int64                   `toml:"readHeaderTimeout"` //读取请求头的最大时长 秒 默认2 修改后需重启
+	MaxHeaderBytes    int                     `toml:"maxHeaderBytes"`    //请求头最大字节数 默认1MB 修改后需重启
+	Timeouts          map[string]RouteTimeout `toml:"timeouts"`          //按控制器或方法覆盖读写超时 [timeouts.控制器] [timeouts."控制器/方法"]
+
+	MaxConns     int   `toml:"maxConns"`     //最大同时打开的连接数 0不限制 修改后需重启
+	MaxRequests  int   `toml:"maxRequests"`  //最大同时处理的请求数 0不限制 超出时排队等待 修改后需重启
+	QueueTimeout int64 `toml:"queueTimeout"` //请求排队的最长等待时间 毫秒 超时返回503 0不等待
+
+	RestartTimeout int64 `toml:"restartTimeout"` //热重启时等待新进程就绪的最长时间 秒 默认30 新进程未就绪则继续使用原进程
 
 	ENV string `toml:"env"` //表示当前环境 本地local  发布dev   测试test
 
-	SIGNCHECK bool   `toml:"signCheck"` //是否验证签名  总开关
-	NSIGN     string `toml:"nSign"`     //不验证签名的class访问 多个,隔开
+	SIGNCHECK  bool              `toml:"signCheck"`  //是否验证签名  总开关
+	NSIGN      string            `toml:"nSign"`      //不验证签名的class访问 多个,隔开
+	SignKeys   map[string]string `toml:"signKeys"`   //app_key对应的签名密钥
+	SignMd5    bool              `toml:"signMd5"`    //是否允许旧版md5签名 默认只允许hmac
+	SignExpire int64             `toml:"signExpire"` //签名有效期 秒 默认300 超时或重复的请求将被拒绝
 
 	IPCHECK bool   `toml:"ipCheck"` //是否校验ip
 	GIPS    string `toml:"gIps"`    //允许通过的ip
@@ -38,11 +69,28 @@ type App struct {
 
 	StaticFiles []StaticFile `toml:"staticFiles"` //允许遍历的静态文件映射目录
 
+	PanicRet int    `toml:"panicRet"` //程序异常时返回的ret 默认500
+	PanicMsg string `toml:"panicMsg"` //程序异常时返回的msg 默认"服务器内部错误"
+
+	LogConf         slog.Config `toml:"log"`             //日志文件切割及保留配置 [log]
+	AccessLogFormat string      `toml:"accessLogFormat"` //访问日志格式 combined(默认) json off不记录 写入logs/access_日期.log
+
+	Limits     []limiter.Rule      `toml:"limit"`      //限流规则 [[limit]] 配合middleware.RateLimit使用
+	LimitStore limiter.StoreConfig `toml:"limitStore"` //限流计数及签名nonce存储 [limitStore] 默认进程内 修改后需重启
+
 	/******以下为自动判断 生成配置******/
 	HOMEDIR   string //程序体文件所在目录  入口目录
 	CONFIGDIR string //程序配置文件所在目录
 
-	Log *slog.NLog //用于 记录日志
+	Log       *slog.NLog   `toml:"-"` //用于 记录日志
+	AccessLog *slog.NLog   `toml:"-"` //访问日志 与应用日志分开存放
+	DB        *db.Manager  `toml:"-"` //数据库连接 按名称获取
+	Limiter   *limiter.Set `toml:"-"` //由Limits生成的限流器
+
+	limitStore limiter.Store
+	limitErrAt int64                //上次记录限流存储错误的时间
+	nonceLocal *limiter.MemoryStore //共享存储不可用时 进程内记录签名nonce
+	nonceOnce  sync.Once
 }
 
 //静态文件映射关系
@@ -52,33 +100,158 @@ type StaticFile struct {
 	Dir    bool   `toml:"dir"`    //是否允许遍历目录下所有文件
 }
 
+//客户端证书策略
+const (
+	ClientCertRequired = "required" //必须提供有效的客户端证书
+	ClientCertOptional = "optional" //提供时可获取客户端身份
+	ClientCertOff      = "off"      //忽略客户端证书
+)
+
+//路由的读写超时 秒 0使用服务默认值 -1不限制
+type RouteTimeout struct {
+	Read  int64 `toml:"read"`
+	Write int64 `toml:"write"`
+}
+
 //新版 启动服务
 func (this *App) Start(handler http.Handler, gracefulReload bool) error {
 	mux := http.NewServeMux()
 	mux.Handle("/", handler)
 
-	httpsPem := ""
-	httpsKey := ""
+	var tlsConf *tls.Config
 	if this.HTTPS {
-		//检测https配置的密钥文件是否存在
-		_, err := os.Stat(this.CONFIGDIR + this.HTTPSPEM)
+		certs := this.TLS.Certs
+		if this.HTTPSPEM != "" && this.HTTPSKEY != "" { //原有配置的证书作为第一组 即默认证书
+			certs = append([]tlsConfig.Cert{{Pem: this.HTTPSPEM, Key: this.HTTPSKEY}}, certs...)
+		}
+
+		store, err := tlsConfig.NewStore(certs, this.CONFIGDIR, this.Log)
 		if err != nil {
 			return err
 		}
 
-		_, err = os.Stat(this.CONFIGDIR + this.HTTPSKEY)
+		tlsConf, err = tlsConfig.New(this.TLS, this.CONFIGDIR, store)
 		if err != nil {
 			return err
 		}
-
-		httpsPem = this.CONFIGDIR + this.HTTPSPEM
-		httpsKey = this.CONFIGDIR + this.HTTPSKEY
 	}
 
 	//不能使用这个 虽然拥有了超时 但是会影响websocket类型转换
 	//timeOutHandler := http.TimeoutHandler(mux, time.Second*30, "处理超时了")
+	//需要更长超时的路由 通过[timeouts]配置或router的Timeout调整
+
+	conf := graceful.Config{
+		Listeners:         this.listeners(),
+		TLSConfig:         tlsConf,
+		HttpsRedirect:     this.HttpsRedirect,
+		ReadTimeout:       serverTimeout(this.ReadTimeout, 30),
+		WriteTimeout:      serverTimeout(this.WriteTimeout, 30),
+		IdleTimeout:       serverTimeout(this.IdleTimeout, 30),
+		ReadHeaderTimeout: serverTimeout(this.ReadHeaderTimeout, 2),
+		MaxHeaderBytes:    this.MaxHeaderBytes,
+		MaxConns:          this.MaxConns,
+		MaxRequests:       this.MaxRequests,
+		QueueTimeout:      time.Duration(this.QueueTimeout) * time.Millisecond,
+		RestartTimeout:    time.Duration(this.RestartTimeout) * time.Second,
+	}
+
+	return graceful.Start(conf, this.Log, mux, gracefulReload)
+}
+
+//按配置生成监听列表 顺序固定 热重启时按顺序继承
+func (this *App) listeners() []graceful.ListenerConfig {
+	var list []graceful.ListenerConfig
+
+	if this.HTTPS && this.HttpsPort == "" { //旧版配置 https使用PORT
+		list = append(list, graceful.ListenerConfig{Kind: graceful.KindHttps, Addr: listenAddr(this.PORT)})
+	} else {
+		if this.HTTP && this.PORT != "" {
+			list = append(list, graceful.ListenerConfig{Kind: graceful.KindHttp, Addr: listenAddr(this.PORT)})
+		}
+		if this.HTTPS {
+			list = append(list, graceful.ListenerConfig{Kind: graceful.KindHttps, Addr: listenAddr(this.HttpsPort)})
+		}
+	}
+
+	if this.UnixSocket != "" {
+		list = append(list, graceful.ListenerConfig{Kind: graceful.KindUnix, Addr: this.UnixSocket})
+	}
+
+	return list
+}
+
+//只有端口时 监听全部地址
+func listenAddr(port string) string {
+	if strings.Contains(port, ":") {
+		return port
+	}
+
+	return ":" + port
+}
+
+//检查客户端证书策略 required需要配置tls.clientCa 否则无法验证任何客户端证书 请求全部被拒绝
+func (this *App) checkClientCert(policies map[string]string) error {
+	for name, p := range policies {
+		switch p {
+		case ClientCertOptional, ClientCertOff:
+		case ClientCertRequired:
+			if this.TLS.ClientCA == "" {
+				return errors.New(name + " = required 需要配置tls.clientCa")
+			}
+		default:
+			return errors.New(name + " = " + p)
+		}
+	}
+
+	return nil
+}
+
+//控制器的客户端证书策略 未配置时使用"*"的配置 默认optional
+func (this *App) ClientCertPolicy(controller string) string {
+	if p, ok := this.ClientCert[controller]; ok {
+		return p
+	}
+	if p, ok := this.ClientCert["*"]; ok {
+		return p
+	}
+
+	return ClientCertOptional
+}
+
+//控制器方法的读写超时 优先使用"控制器/方法"的配置 其次为控制器的配置
+//返回0表示未配置 小于0表示不限制 只对HTTP/1.x请求生效
+func (this *App) RouteTimeout(controller, method string) (read, write time.Duration) {
+	t, ok := this.Timeouts[controller+"/"+method]
+	if !ok {
+		t, ok = this.Timeouts[controller]
+	}
+	if !ok {
+		return 0, 0
+	}
+
+	return seconds(t.Read, 0), seconds(t.Write, 0)
+}
+
+//秒转换为时长 0使用默认值 小于0表示不限制
+func seconds(v int64, def int64) time.Duration {
+	if v == 0 {
+		v = def
+	}
+	if v < 0 {
+		return -1
+	}
+
+	return time.Duration(v) * time.Second
+}
 
-	return graceful.Start(":"+this.PORT, this.Log, mux, httpsPem, httpsKey, gracefulReload)
+//http服务的超时 不限制时为0
+func serverTimeout(v int64, def int64) time.Duration {
+	d := seconds(v, def)
+	if d < 0 {
+		return 0
+	}
+
+	return d
 }
 
 //判断class是否能通过ip检查
@@ -150,7 +323,35 @@ func NewApp(appConfig string) *App {
 	myApp.CONFIGDIR, _ = commonFunc.FindConfigPath(configFile)
 
 	//初始化自定义的log库
+	slog.SetConfig(myApp.LogConf)
 	myApp.Log = slog.NewLog(myApp.ENV, "")
+	myApp.AccessLog = slog.NewLog(myApp.ENV, "access_")
+
+	//初始化数据库连接 首次使用时才真正建立连接
+	myApp.DB, err = db.NewManager(myApp.Databases)
+	if err != nil {
+		log.Fatal("数据库配置错误：", err)
+	}
+
+	err = myApp.DB.SetShards(myApp.Shards)
+	if err != nil {
+		log.Fatal("分库分表配置错误：", err)
+	}
+
+	if err = myApp.checkClientCert(myApp.ClientCert); err != nil {
+		log.Fatal("客户端证书策略配置错误：", err)
+	}
+
+	myApp.limitStore, err = limiter.NewStore(myApp.LimitStore)
+	if err != nil {
+		log.Fatal("限流存储配置错误：", err)
+	}
+
+	myApp.Limiter, err = limiter.NewSet(myApp.Limits, myApp.limitStore, myApp.limitError)
+	if err != nil {
+		log.Fatal("限流配置错误：", err)
+	}
+	myApp.warnLocalLimits(myApp.Limits)
 
 	//fmt.Println(myApp)
 	//检测配置文件修改 则修改APP设置
@@ -178,13 +379,85 @@ func resetAppConfig(app *App, configFile string) {
 
 	app.SIGNCHECK = myTmpApp.SIGNCHECK
 	app.NSIGN = myTmpApp.NSIGN
+	app.SignKeys = myTmpApp.SignKeys
+	app.SignMd5 = myTmpApp.SignMd5
+	app.SignExpire = myTmpApp.SignExpire
 
 	app.StaticFiles = myTmpApp.StaticFiles
+	app.Timeouts = myTmpApp.Timeouts
+	if err := app.checkClientCert(myTmpApp.ClientCert); err != nil {
+		app.Log.Error("客户端证书策略配置错误 继续使用原配置：" + err.Error())
+	} else {
+		app.ClientCert = myTmpApp.ClientCert
+	}
+
+	app.AccessLogFormat = myTmpApp.AccessLogFormat
+	app.LogConf = myTmpApp.LogConf
+	slog.SetConfig(app.LogConf)
+
+	app.PanicRet = myTmpApp.PanicRet
+	app.PanicMsg = myTmpApp.PanicMsg
+
+	//规则变化时才重建 避免清空已有的计数
+	if !reflect.DeepEqual(app.Limits, myTmpApp.Limits) {
+		set, err := limiter.NewSet(myTmpApp.Limits, app.limitStore, app.limitError)
+		if err != nil {
+			app.Log.Error("限流配置错误 继续使用原配置：" + err.Error())
+		} else {
+			app.Limits = myTmpApp.Limits
+			app.Limiter = set
+			app.warnLocalLimits(app.Limits)
+		}
+	}
+}
+
+//限流存储出错时请求会被放行 记录错误便于排查 每10秒最多记录一次
+func (this *App) limitError(err error) {
+	now := time.Now().Unix()
+	last := atomic.LoadInt64(&this.limitErrAt)
+	if now-last < 10 || !atomic.CompareAndSwapInt64(&this.limitErrAt, last, now) {
+		return
+	}
+
+	this.Log.Error("限流存储错误：" + err.Error())
+}
+
+//共享存储只对window算法生效 令牌桶规则仍在每台机器上单独计数 多台机器时总配额为机器数倍
+func (this *App) warnLocalLimits(rules []limiter.Rule) {
+	if this.LimitStore.Type != limiter.StoreRedis {
+		return
+	}
+
+	for i, r := range rules {
+		if r.Algorithm == "" || r.Algorithm == limiter.AlgorithmToken {
+			this.Log.Warn("第" + strconv.Itoa(i+1) + "条限流规则使用令牌桶 只在单机内计数 不与其他机器共享配额 需共享请使用window算法")
+		}
+	}
+}
+
+//记录签名的nonce 有效期内已使用过时返回false
+//与限流共用[limitStore]存储 配置redis时多台机器共同防重放 默认只在当前进程内有效
+//存储出错或未经NewApp创建时退回进程内记录
+func (this *App) UseNonce(key string, ttl time.Duration) bool {
+	if this.limitStore != nil {
+		n, err := this.limitStore.Incr("nonce:"+key, ttl)
+		if err == nil {
+			return n == 1
+		}
+		this.limitError(err)
+	}
+
+	this.nonceOnce.Do(func() {
+		this.nonceLocal = limiter.NewMemoryStore()
+	})
+	n, _ := this.nonceLocal.Incr("nonce:"+key, ttl)
+
+	return n == 1
 }
 
 //检测当前环境下 可执行文件是否有更新，如果存在更新 则 给自己发送升级信号
 func (this *App) hasNewKillSelf() {
-	a, _ := filepath.Abs(os.Args[0])
+	a := graceful.Executable()
 	af, _ := os.Stat(a)
 	aLT := af.ModTime().Unix()
 	go func() {
@@ -0,0 +1,329 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	slog "github.com/solaa51/gosab/system/core/log"
+)
+
+/**
+熔断器与并发隔离
+closed: 正常放行 统计窗口内失败率达到阈值后进入open
+open: 直接拒绝 冷却时间过后进入half-open
+half-open: 放行少量探测请求 全部成功恢复closed 任一失败重新open
+MaxConcurrent大于0时 同时执行的调用数超过上限将等待MaxWait后拒绝
+*/
+
+const (
+	StateClosed   = "closed"
+	StateOpen     = "open"
+	StateHalfOpen = "half-open"
+)
+
+var (
+	ErrOpen         = errors.New("熔断器已打开")
+	ErrHalfOpenFull = errors.New("熔断器半开 探测请求已满")
+	ErrBulkheadFull = errors.New("并发数已达上限")
+)
+
+//熔断配置 零值使用默认值
+type Config struct {
+	Window        time.Duration //失败率统计窗口 默认10秒
+	MinRequests   int64         //窗口内请求数达到此值才判断失败率 默认10
+	FailureRatio  float64       //失败率阈值 默认0.5
+	CoolDown      time.Duration //open状态持续时间 默认30秒
+	HalfOpenMax   int64         //half-open状态放行的探测请求数 默认1
+	MaxConcurrent int           //最大并发数 0不限制
+	MaxWait       time.Duration //并发已满时的最长等待时间 0直接拒绝
+}
+
+//运行状态 用于监控
+type Stats struct {
+	Name      string    `json:"name"`
+	State     string    `json:"state"`
+	Since     time.Time `json:"since"`     //进入当前状态的时间
+	Requests  int64     `json:"requests"`  //当前窗口请求数
+	Failures  int64     `json:"failures"`  //当前窗口失败数
+	Inflight  int       `json:"inflight"`  //正在执行的调用数
+	Rejected  int64     `json:"rejected"`  //累计拒绝次数
+	Successes int64     `json:"successes"` //累计成功次数
+	Errors    int64     `json:"errors"`    //累计失败次数
+}
+
+type Breaker struct {
+	name string
+	conf Config
+	log  *slog.NLog
+	sem  chan struct{}
+
+	mu          sync.Mutex
+	state       string
+	since       time.Time
+	windowStart time.Time
+	requests    int64
+	failures    int64
+	probes      int64 //half-open状态已放行的探测数
+	probeOk     int64 //half-open状态已成功的探测数
+	rejected    int64
+	successes   int64
+	errors      int64
+}
+
+//log为空时不记录状态变化
+func New(name string, conf Config, log *slog.NLog) *Breaker {
+	if conf.Window <= 0 {
+		conf.Window = 10 * time.Second
+	}
+	if conf.MinRequests <= 0 {
+		conf.MinRequests = 10
+	}
+	if conf.FailureRatio <= 0 || conf.FailureRatio > 1 {
+		conf.FailureRatio = 0.5
+	}
+	if conf.CoolDown <= 0 {
+		conf.CoolDown = 30 * time.Second
+	}
+	if conf.HalfOpenMax <= 0 {
+		conf.HalfOpenMax = 1
+	}
+
+	b := &Breaker{
+		name:        name,
+		conf:        conf,
+		log:         log,
+		state:       StateClosed,
+		since:       time.Now(),
+		windowStart: time.Now(),
+	}
+	if conf.MaxConcurrent > 0 {
+		b.sem = make(chan struct{}, conf.MaxConcurrent)
+	}
+
+	return b
+}
+
+func (this *Breaker) Name() string {
+	return this.name
+}
+
+//执行fn fn返回错误计为失败
+func (this *Breaker) Do(fn func() error) error {
+	return this.DoContext(context.Background(), fn)
+}
+
+//执行fn 等待并发名额时受ctx控制
+func (this *Breaker) DoContext(ctx context.Context, fn func() error) error {
+	return this.Execute(ctx, func() (bool, error) {
+		err := fn()
+		return err == nil, err
+	})
+}
+
+//执行fn 由fn返回的ok决定是否计为成功 用于错误与失败不一致的场景 如http 5xx
+//fn panic时计为失败 并归还并发及探测名额
+func (this *Breaker) Execute(ctx context.Context, fn func() (bool, error)) error {
+	finish, err := this.Start(ctx)
+	if err != nil {
+		return err
+	}
+
+	ok := false
+	defer func() {
+		finish(ok)
+	}()
+
+	ok, err = fn()
+
+	return err
+}
+
+//开始一次调用 返回的finish在调用结束时执行 ok为是否成功 多次执行只生效一次
+//执行finish之前一直占用并发名额 用于函数返回后调用才结束的场景 如读取http响应体
+func (this *Breaker) Start(ctx context.Context) (finish func(ok bool), err error) {
+	if err = this.allow(); err != nil {
+		return nil, err
+	}
+
+	if err = this.acquire(ctx); err != nil {
+		this.done(true, false)
+		return nil, err
+	}
+
+	var once sync.Once
+	return func(ok bool) {
+		once.Do(func() {
+			this.done(false, ok)
+			this.release()
+		})
+	}, nil
+}
+
+func (this *Breaker) State() string {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.refresh(time.Now())
+	return this.state
+}
+
+func (this *Breaker) Stats() Stats {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.refresh(time.Now())
+	return Stats{
+		Name:      this.name,
+		State:     this.state,
+		Since:     this.since,
+		Requests:  this.requests,
+		Failures:  this.failures,
+		Inflight:  len(this.sem),
+		Rejected:  this.rejected,
+		Successes: this.successes,
+		Errors:    this.errors,
+	}
+}
+
+//判断是否放行
+func (this *Breaker) allow() error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.refresh(time.Now())
+
+	switch this.state {
+	case StateOpen:
+		this.rejected++
+		return ErrOpen
+	case StateHalfOpen:
+		if this.probes >= this.conf.HalfOpenMax {
+			this.rejected++
+			return ErrHalfOpenFull
+		}
+		this.probes++
+	}
+
+	return nil
+}
+
+//记录调用结果 skipped为true表示未实际执行 仅归还探测名额
+func (this *Breaker) done(skipped, ok bool) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	now := time.Now()
+	this.refresh(now)
+
+	if skipped {
+		this.rejected++
+		if this.state == StateHalfOpen && this.probes > 0 {
+			this.probes--
+		}
+		return
+	}
+
+	if ok {
+		this.successes++
+	} else {
+		this.errors++
+	}
+
+	switch this.state {
+	case StateClosed:
+		this.requests++
+		if !ok {
+			this.failures++
+		}
+		if this.requests >= this.conf.MinRequests && float64(this.failures)/float64(this.requests) >= this.conf.FailureRatio {
+			this.setState(StateOpen, now)
+		}
+	case StateHalfOpen:
+		if !ok {
+			this.setState(StateOpen, now)
+			return
+		}
+		this.probeOk++
+		if this.probeOk >= this.conf.HalfOpenMax {
+			this.setState(StateClosed, now)
+		}
+	}
+}
+
+//按时间推进状态 调用方需持有锁
+func (this *Breaker) refresh(now time.Time) {
+	switch this.state {
+	case StateClosed:
+		if now.Sub(this.windowStart) >= this.conf.Window {
+			this.windowStart = now
+			this.requests = 0
+			this.failures = 0
+		}
+	case StateOpen:
+		if now.Sub(this.since) >= this.conf.CoolDown {
+			this.setState(StateHalfOpen, now)
+		}
+	}
+}
+
+//调用方需持有锁
+func (this *Breaker) setState(state string, now time.Time) {
+	if this.state == state {
+		return
+	}
+
+	if this.log != nil {
+		msg := "熔断器状态变化 " + this.state + " -> " + state
+		fields := []slog.Field{slog.F("breaker", this.name), slog.F("requests", this.requests), slog.F("failures", this.failures)}
+		if state == StateOpen {
+			this.log.Warn(msg, fields...)
+		} else {
+			this.log.Info(msg, fields...)
+		}
+	}
+
+	this.state = state
+	this.since = now
+	this.windowStart = now
+	this.requests = 0
+	this.failures = 0
+	this.probes = 0
+	this.probeOk = 0
+}
+
+//获取并发名额
+func (this *Breaker) acquire(ctx context.Context) error {
+	if this.sem == nil {
+		return nil
+	}
+
+	select {
+	case this.sem <- struct{}{}:
+		return nil
+	default:
+	}
+
+	if this.conf.MaxWait <= 0 {
+		return ErrBulkheadFull
+	}
+
+	timer := time.NewTimer(this.conf.MaxWait)
+	defer timer.Stop()
+
+	select {
+	case this.sem <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return ErrBulkheadFull
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (this *Breaker) release() {
+	if this.sem != nil {
+		<-this.sem
+	}
+}
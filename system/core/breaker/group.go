@@ -0,0 +1,140 @@
+package breaker
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/solaa51/gosab/system/core/commonFunc"
+	slog "github.com/solaa51/gosab/system/core/log"
+)
+
+//按目标分组的熔断器 同一组共用配置 首次使用时创建
+type Group struct {
+	conf Config
+	log  *slog.NLog
+
+	mu       sync.RWMutex
+	breakers map[string]*Breaker
+}
+
+func NewGroup(conf Config, log *slog.NLog) *Group {
+	return &Group{
+		conf:     conf,
+		log:      log,
+		breakers: make(map[string]*Breaker),
+	}
+}
+
+//获取指定目标的熔断器
+func (this *Group) Get(name string) *Breaker {
+	this.mu.RLock()
+	b, ok := this.breakers[name]
+	this.mu.RUnlock()
+	if ok {
+		return b
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if b, ok = this.breakers[name]; !ok {
+		b = New(name, this.conf, this.log)
+		this.breakers[name] = b
+	}
+
+	return b
+}
+
+func (this *Group) Do(name string, fn func() error) error {
+	return this.Get(name).Do(fn)
+}
+
+func (this *Group) DoContext(ctx context.Context, name string, fn func() error) error {
+	return this.Get(name).DoContext(ctx, fn)
+}
+
+//全部熔断器的运行状态 按名称排序
+func (this *Group) Snapshot() []Stats {
+	this.mu.RLock()
+	list := make([]*Breaker, 0, len(this.breakers))
+	for _, b := range this.breakers {
+		list = append(list, b)
+	}
+	this.mu.RUnlock()
+
+	stats := make([]Stats, 0, len(list))
+	for _, b := range list {
+		stats = append(stats, b.Stats())
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Name < stats[j].Name
+	})
+
+	return stats
+}
+
+/**
+用于commonFunc.ClientConfig.Guard 按请求的host分别熔断
+网络错误、5xx响应及读取响应体出错计为失败
+并发名额在响应体读完或关闭后才归还 使用DoRaw时需关闭响应体
+
+	group := breaker.NewGroup(breaker.Config{MaxConcurrent: 50}, APP.Log)
+	client := commonFunc.NewClient(commonFunc.ClientConfig{Guard: group.Guard()})
+*/
+func (this *Group) Guard() commonFunc.GuardFunc {
+	return func(req *http.Request, send func() (*http.Response, error)) (*http.Response, error) {
+		finish, err := this.Get(req.URL.Host).Start(req.Context())
+		if err != nil {
+			return nil, err
+		}
+
+		handed := false
+		defer func() {
+			if !handed { //发送出错或panic
+				finish(false)
+			}
+		}()
+
+		res, err := send()
+		if err != nil {
+			return nil, err
+		}
+
+		handed = true
+		if res.Body == nil {
+			finish(res.StatusCode < 500)
+			return res, nil
+		}
+		res.Body = &guardedBody{ReadCloser: res.Body, ok: res.StatusCode < 500, finish: finish}
+
+		return res, nil
+	}
+}
+
+//读完或关闭响应体时结束熔断器的本次调用
+type guardedBody struct {
+	io.ReadCloser
+	ok     bool
+	finish func(ok bool)
+}
+
+func (this *guardedBody) Read(p []byte) (int, error) {
+	n, err := this.ReadCloser.Read(p)
+	if err == io.EOF {
+		this.finish(this.ok)
+	} else if err != nil {
+		this.ok = false
+	}
+
+	return n, err
+}
+
+func (this *guardedBody) Close() error {
+	err := this.ReadCloser.Close()
+	this.finish(this.ok)
+
+	return err
+}
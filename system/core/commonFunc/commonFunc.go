@@ -3,6 +3,7 @@ package commonFunc
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"crypto/md5"
 	"crypto/rand"
 	"encoding/hex"
@@ -260,7 +261,7 @@ func TimeStrToTime(str string) int64 {
 
 //只支持一级 生成url 查询字符串
 func SortBuildQuery(data map[string]interface{}) string {
-	key := make([]string, len(data))
+	key := make([]string, 0, len(data))
 	for k, _ := range data {
 		key = append(key, k)
 	}
@@ -347,120 +348,62 @@ func InternetIp() string {
 	return strings.TrimSpace(ip)
 }
 
+//兼容原有GetPost系列函数的客户端 保持原User-Agent和form表单提交方式
+//与原实现一致 不限制整体超时和响应大小 需要限制时使用NewClient
+const legacyUserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_1) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/77.0.3865.120 Safari/537.36"
+
+var (
+	legacyClient         = NewClient(ClientConfig{Timeout: -1, ConnectTimeout: 30 * time.Second, MaxBodySize: -1, UserAgent: legacyUserAgent})
+	legacyRedirectClient = NewClient(ClientConfig{Timeout: -1, ConnectTimeout: 30 * time.Second, MaxBodySize: -1, UserAgent: legacyUserAgent, FollowRedirect: true})
+)
+
 /**
 发送get 或 post请求 获取数据
 */
 func GetPost(method string, sUrl string, data map[string]string, head map[string]string, cookie []*http.Cookie) (string, error) {
-	client := &http.Client{
-		CheckRedirect: func(req *http.Request, via []*http.Request) error { //禁止自动跳转
-			return http.ErrUseLastResponse
-		},
-	}
-
-	//请求体数据
-	var postBody *strings.Reader
-	if data != nil {
-		pData := url.Values{}
-		for k, v := range data {
-			pData.Add(k, v)
-		}
-		postBody = strings.NewReader(pData.Encode())
-	} else {
-		postBody = strings.NewReader("")
-	}
-
-	req, err := http.NewRequest(method, sUrl, postBody)
-	if err != nil {
-		return "", err
-	}
-	req.Close = true
-
-	if _, ok := head["User-Agent"]; !ok {
-		req.Header.Add("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_1) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/77.0.3865.120 Safari/537.36")
-	}
-	if _, ok := head["Content-Type"]; !ok {
-		req.Header.Add("Content-Type", "application/x-www-form-urlencoded; charset=UTF-8")
-	}
-	if head != nil {
-		for k, v := range head {
-			if v != "" {
-				req.Header.Add(k, v)
-			}
-		}
-	}
-
-	if cookie != nil {
-		for _, c := range cookie {
-			req.AddCookie(c)
-		}
-	}
-
-	response, err := client.Do(req)
-	if err != nil {
-		return "", err
-	}
+	return GetPostContext(context.Background(), method, sUrl, data, head, cookie)
+}
 
-	body, err := ioutil.ReadAll(response.Body)
+/**
+发送get 或 post请求 获取数据
+ctx中包含请求ID时 通过X-Request-Id请求头传递给对方
+*/
+func GetPostContext(ctx context.Context, method string, sUrl string, data map[string]string, head map[string]string, cookie []*http.Cookie) (string, error) {
+	res, err := legacyClient.Do(ctx, legacyRequest(method, sUrl, data, head, cookie))
 	if err != nil {
 		return "", err
 	}
-	defer response.Body.Close()
 
-	return string(body), nil
+	return string(res.Body), nil
 }
 
 /**
 发送get 或 post请求 获取数据 返回response和error
 */
 func GetPostRequest(method string, sUrl string, data map[string]string, head map[string]string, cookie []*http.Cookie, redirect bool) (*http.Response, error) {
-	client := &http.Client{
-		CheckRedirect: func(req *http.Request, via []*http.Request) error { //禁止自动跳转
-			if redirect {
-				return nil
-			} else {
-				return http.ErrUseLastResponse
-			}
-		},
-	}
-
-	//请求体数据
-	var postBody *strings.Reader
-	if data != nil {
-		pData := url.Values{}
-		for k, v := range data {
-			pData.Add(k, v)
-		}
-		postBody = strings.NewReader(pData.Encode())
-	} else {
-		postBody = strings.NewReader("")
-	}
+	return GetPostRequestContext(context.Background(), method, sUrl, data, head, cookie, redirect)
+}
 
-	req, err := http.NewRequest(method, sUrl, postBody)
-	if err != nil {
-		return nil, err
+/**
+发送get 或 post请求 获取数据 返回response和error
+ctx中包含请求ID时 通过X-Request-Id请求头传递给对方
+*/
+func GetPostRequestContext(ctx context.Context, method string, sUrl string, data map[string]string, head map[string]string, cookie []*http.Cookie, redirect bool) (*http.Response, error) {
+	client := legacyClient
+	if redirect {
+		client = legacyRedirectClient
 	}
 
-	if _, ok := head["User-Agent"]; !ok {
-		req.Header.Add("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_1) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/77.0.3865.120 Safari/537.36")
-	}
-	if _, ok := head["Content-Type"]; !ok {
-		req.Header.Add("Content-Type", "application/x-www-form-urlencoded; charset=UTF-8")
-	}
-	if head != nil {
-		for k, v := range head {
-			if v != "" {
-				req.Header.Add(k, v)
-			}
-		}
-	}
+	return client.DoRaw(ctx, legacyRequest(method, sUrl, data, head, cookie))
+}
 
-	if cookie != nil {
-		for _, c := range cookie {
-			req.AddCookie(c)
-		}
+//原有函数的请求参数 始终以form表单提交
+func legacyRequest(method string, sUrl string, data map[string]string, head map[string]string, cookie []*http.Cookie) *Request {
+	if data == nil {
+		data = map[string]string{}
 	}
 
-	return client.Do(req)
+	return &Request{Method: method, Url: sUrl, Form: data, Header: head, Cookies: cookie}
 }
 
 //utf8编码 转 gbk编码
@@ -477,12 +420,35 @@ func GBK2UTF8(str []byte) ([]byte, error) {
 	return b, err
 }
 
-//给数据库分表计算
+//给数据库分表计算 固定分10张表
 func Mod(id int64) int64 {
-	str := strconv.FormatInt(id, 10)
+	return ModN(id, 10)
+}
+
+//给数据库分表计算 按crc32分n张表
+func ModN(id int64, n int64) int64 {
+	return CrcMod(strconv.FormatInt(id, 10), n)
+}
+
+//按字符串的crc32值 分n张表
+func CrcMod(str string, n int64) int64 {
+	if n <= 0 {
+		return 0
+	}
+
 	shu := crc32.ChecksumIEEE([]byte(str))
 
-	return int64(math.Mod(float64(shu), 10))
+	return int64(math.Mod(float64(shu), float64(n)))
+}
+
+//生成32位随机唯一标识 可用作请求ID等
+func UniqueId() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+
+	return hex.EncodeToString(b)
 }
 
 //生成随机数[n - m)
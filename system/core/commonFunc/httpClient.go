@@ -0,0 +1,370 @@
+package commonFunc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+可复用的http客户端
+连接池按host复用 支持超时、幂等请求的重试退避、json/form/multipart/原始请求体、响应大小限制
+BeforeRequest 可用于签名 AfterResponse 可用于记录日志
+
+使用方法:
+	client := commonFunc.NewClient(commonFunc.ClientConfig{Timeout: 5 * time.Second, Retries: 2})
+	res, err := client.Do(ctx.Context(), &commonFunc.Request{Method: "POST", Url: u, Json: data})
+*/
+
+var ErrBodyTooLarge = errors.New("响应内容超过大小限制")
+
+//客户端配置 零值使用默认值
+type ClientConfig struct {
+	Timeout             time.Duration //单次请求的整体超时 默认30秒 小于0不限制
+	ConnectTimeout      time.Duration //建立连接超时 默认5秒
+	MaxIdleConnsPerHost int           //每个host保留的空闲连接 默认10
+	MaxConnsPerHost     int           //每个host最大连接数 0不限制
+	IdleConnTimeout     time.Duration //空闲连接保留时间 默认90秒
+
+	Retries      int           //幂等请求失败后的重试次数 默认不重试
+	RetryBackoff time.Duration //首次重试等待时间 之后每次翻倍 默认100毫秒
+
+	MaxBodySize    int64  //响应内容最大字节数 默认10MB 小于0不限制
+	UserAgent      string //默认User-Agent
+	FollowRedirect bool   //是否自动跳转
+
+	BeforeRequest func(req *http.Request) error                                              //每次发送前调用 可用于签名 返回错误则不发送
+	AfterResponse func(req *http.Request, res *http.Response, err error, cost time.Duration) //每次请求完成后调用 可用于记录日志
+	Guard         GuardFunc                                                                  //包装每次发送 可用于熔断及并发隔离
+}
+
+//包装一次发送 send为实际发送请求
+type GuardFunc func(req *http.Request, send func() (*http.Response, error)) (*http.Response, error)
+
+//请求参数 Json Form Body 只使用其中一种 Files不为空时使用multipart
+type Request struct {
+	Method  string
+	Url     string
+	Query   url.Values
+	Header  map[string]string
+	Cookies []*http.Cookie
+
+	Form  map[string]string //x-www-form-urlencoded 或multipart的普通字段
+	Json  interface{}       //application/json
+	Body  []byte            //原始请求体 Content-Type需在Header中指定
+	Files []FormFile        //multipart上传的文件
+
+	Idempotent bool //非GET等幂等方法时 标记为可安全重试
+}
+
+//multipart上传的文件
+type FormFile struct {
+	Field    string
+	FileName string
+	Content  []byte
+}
+
+//响应结果
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+type Client struct {
+	conf   ClientConfig
+	client *http.Client
+}
+
+//默认客户端
+var DefaultClient = NewClient(ClientConfig{})
+
+func NewClient(conf ClientConfig) *Client {
+	if conf.Timeout == 0 {
+		conf.Timeout = 30 * time.Second
+	}
+	if conf.ConnectTimeout <= 0 {
+		conf.ConnectTimeout = 5 * time.Second
+	}
+	if conf.MaxIdleConnsPerHost <= 0 {
+		conf.MaxIdleConnsPerHost = 10
+	}
+	if conf.IdleConnTimeout <= 0 {
+		conf.IdleConnTimeout = 90 * time.Second
+	}
+	if conf.RetryBackoff <= 0 {
+		conf.RetryBackoff = 100 * time.Millisecond
+	}
+	if conf.MaxBodySize == 0 {
+		conf.MaxBodySize = 10 << 20
+	}
+	if conf.UserAgent == "" {
+		conf.UserAgent = "gosab-http-client/1.0"
+	}
+
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   conf.ConnectTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          conf.MaxIdleConnsPerHost * 10,
+		MaxIdleConnsPerHost:   conf.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       conf.MaxConnsPerHost,
+		IdleConnTimeout:       conf.IdleConnTimeout,
+		TLSHandshakeTimeout:   conf.ConnectTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+
+	c := &http.Client{Transport: transport}
+	if conf.Timeout > 0 {
+		c.Timeout = conf.Timeout
+	}
+	if !conf.FollowRedirect {
+		c.CheckRedirect = func(req *http.Request, via []*http.Request) error { //禁止自动跳转
+			return http.ErrUseLastResponse
+		}
+	}
+
+	return &Client{conf: conf, client: c}
+}
+
+//设置Guard 需在启动时调用
+func (this *Client) SetGuard(guard GuardFunc) {
+	this.conf.Guard = guard
+}
+
+//为DefaultClient及GetPost系列函数设置Guard 需在启动时调用
+func UseGuard(guard GuardFunc) {
+	DefaultClient.SetGuard(guard)
+	legacyClient.SetGuard(guard)
+	legacyRedirectClient.SetGuard(guard)
+}
+
+//发送请求并读取全部响应内容
+func (this *Client) Do(ctx context.Context, req *Request) (*Response, error) {
+	res, err := this.DoRaw(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if this.conf.MaxBodySize < 0 {
+		body, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		return &Response{StatusCode: res.StatusCode, Header: res.Header, Body: body}, nil
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, this.conf.MaxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(body)) > this.conf.MaxBodySize {
+		return nil, ErrBodyTooLarge
+	}
+
+	return &Response{StatusCode: res.StatusCode, Header: res.Header, Body: body}, nil
+}
+
+//发送请求 返回原始响应 响应体需调用方读取并关闭
+func (this *Client) DoRaw(ctx context.Context, req *Request) (*http.Response, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	body, contentType, err := req.body()
+	if err != nil {
+		return nil, err
+	}
+
+	retries := 0
+	if req.Idempotent || isIdempotent(req.Method) {
+		retries = this.conf.Retries
+	}
+
+	backoff := this.conf.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		res, err := this.send(ctx, req, body, contentType)
+
+		//网络错误或服务端5xx错误时重试
+		retry := attempt < retries && (err != nil || res.StatusCode >= 500)
+		if !retry {
+			return res, err
+		}
+
+		if res != nil {
+			_, _ = io.Copy(ioutil.Discard, io.LimitReader(res.Body, 64<<10))
+			_ = res.Body.Close()
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+//GET请求
+func (this *Client) Get(ctx context.Context, sUrl string, head map[string]string) (*Response, error) {
+	return this.Do(ctx, &Request{Method: http.MethodGet, Url: sUrl, Header: head})
+}
+
+//form表单POST请求
+func (this *Client) PostForm(ctx context.Context, sUrl string, data map[string]string, head map[string]string) (*Response, error) {
+	return this.Do(ctx, &Request{Method: http.MethodPost, Url: sUrl, Form: data, Header: head})
+}
+
+//json POST请求
+func (this *Client) PostJson(ctx context.Context, sUrl string, data interface{}, head map[string]string) (*Response, error) {
+	return this.Do(ctx, &Request{Method: http.MethodPost, Url: sUrl, Json: data, Header: head})
+}
+
+//发送一次请求
+func (this *Client) send(ctx context.Context, req *Request, body []byte, contentType string) (*http.Response, error) {
+	sUrl := req.Url
+	if len(req.Query) > 0 {
+		if strings.Contains(sUrl, "?") {
+			sUrl += "&" + req.Query.Encode()
+		} else {
+			sUrl += "?" + req.Query.Encode()
+		}
+	}
+
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	r, err := http.NewRequest(method, sUrl, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	r = r.WithContext(ctx)
+	if len(body) == 0 {
+		r.Body = http.NoBody
+		r.ContentLength = 0
+	}
+
+	r.Header.Set("User-Agent", this.conf.UserAgent)
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	if id := RequestIdFromContext(ctx); id != "" {
+		r.Header.Set("X-Request-Id", id)
+	}
+	for k, v := range req.Header {
+		if v != "" {
+			r.Header.Set(k, v)
+		}
+	}
+	for _, c := range req.Cookies {
+		r.AddCookie(c)
+	}
+
+	if this.conf.BeforeRequest != nil {
+		if err = this.conf.BeforeRequest(r); err != nil {
+			return nil, err
+		}
+	}
+
+	start := time.Now()
+	var res *http.Response
+	if this.conf.Guard != nil {
+		res, err = this.conf.Guard(r, func() (*http.Response, error) {
+			return this.client.Do(r)
+		})
+	} else {
+		res, err = this.client.Do(r)
+	}
+
+	if this.conf.AfterResponse != nil {
+		this.conf.AfterResponse(r, res, err, time.Since(start))
+	}
+
+	return res, err
+}
+
+//生成请求体 重试时复用
+func (this *Request) body() ([]byte, string, error) {
+	switch {
+	case len(this.Files) > 0:
+		var buf bytes.Buffer
+		w := multipart.NewWriter(&buf)
+		for k, v := range this.Form {
+			if err := w.WriteField(k, v); err != nil {
+				return nil, "", err
+			}
+		}
+		for _, f := range this.Files {
+			fw, err := w.CreateFormFile(f.Field, f.FileName)
+			if err != nil {
+				return nil, "", err
+			}
+			if _, err = fw.Write(f.Content); err != nil {
+				return nil, "", err
+			}
+		}
+		if err := w.Close(); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), w.FormDataContentType(), nil
+	case this.Json != nil:
+		b, err := json.Marshal(this.Json)
+		if err != nil {
+			return nil, "", err
+		}
+		return b, "application/json; charset=UTF-8", nil
+	case this.Form != nil:
+		data := url.Values{}
+		for k, v := range this.Form {
+			data.Add(k, v)
+		}
+		return []byte(data.Encode()), "application/x-www-form-urlencoded; charset=UTF-8", nil
+	default:
+		return this.Body, "", nil
+	}
+}
+
+//可安全重试的请求方法
+func isIdempotent(method string) bool {
+	switch strings.ToUpper(method) {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	return false
+}
+
+//响应状态码是否为2xx
+func (this *Response) OK() bool {
+	return this.StatusCode >= 200 && this.StatusCode < 300
+}
+
+func (this *Response) String() string {
+	return string(this.Body)
+}
+
+//将响应内容解析为json
+func (this *Response) Json(v interface{}) error {
+	if len(this.Body) == 0 {
+		return errors.New("响应内容为空 状态码:" + strconv.Itoa(this.StatusCode))
+	}
+
+	return json.Unmarshal(this.Body, v)
+}
@@ -0,0 +1,33 @@
+package commonFunc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+//GetPost系列与原实现一致 不限制响应大小 新客户端默认限制10MB
+func TestBodySizeLimit(t *testing.T) {
+	body := strings.Repeat("x", 11<<20)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}))
+	defer s.Close()
+
+	got, err := GetPost(http.MethodGet, s.URL, nil, nil, nil)
+	if err != nil || len(got) != len(body) {
+		t.Fatalf("GetPost read %d bytes, %v", len(got), err)
+	}
+
+	if _, err = DefaultClient.Do(context.Background(), &Request{Method: http.MethodGet, Url: s.URL}); err != ErrBodyTooLarge {
+		t.Fatalf("DefaultClient error = %v, want ErrBodyTooLarge", err)
+	}
+
+	unlimited := NewClient(ClientConfig{MaxBodySize: -1})
+	res, err := unlimited.Do(context.Background(), &Request{Method: http.MethodGet, Url: s.URL})
+	if err != nil || len(res.Body) != len(body) {
+		t.Fatalf("unlimited client error = %v", err)
+	}
+}
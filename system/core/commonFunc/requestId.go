@@ -0,0 +1,21 @@
+package commonFunc
+
+import "context"
+
+//请求ID在context中的key
+type requestIdKey struct{}
+
+//将请求ID放入context 发起请求时自动通过X-Request-Id请求头传递
+func WithRequestId(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIdKey{}, id)
+}
+
+//从context中获取请求ID 不存在时返回空字符串
+func RequestIdFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	id, _ := ctx.Value(requestIdKey{}).(string)
+	return id
+}
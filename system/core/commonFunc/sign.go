@@ -0,0 +1,153 @@
+package commonFunc
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+/**
+请求签名
+待签名字符串: 公共参数(不含sign和param)排序拼接 + "&" + 业务参数排序拼接
+签名方式: hmac 即HMAC-SHA256(默认), md5 旧版兼容 md5(待签名字符串+密钥)
+服务端与客户端共用 保证两端规则一致
+*/
+
+const (
+	SignHmac = "hmac" //HMAC-SHA256
+	SignMd5  = "md5"  //旧版md5签名
+)
+
+//生成待签名字符串
+//common 公共参数 sign和param字段不参与签名
+//param 业务参数 只支持一级 复杂类型按json字符串参与签名
+//按key排序 key和值url编码后以&拼接 与SortBuildQuery不同:
+//小数使用最短的精确格式 如1.001不会变成1.00 值为null时只有key 与空字符串区分
+func SignString(common map[string]interface{}, param map[string]interface{}) string {
+	c := make(map[string]interface{}, len(common))
+	for k, v := range common {
+		if k == "sign" || k == "param" {
+			continue
+		}
+		c[k] = v
+	}
+
+	return signQuery(c) + "&" + signQuery(param)
+}
+
+//按签名方式 对待签名字符串签名
+func Sign(signType, secret, str string) string {
+	if signType == SignMd5 {
+		return Md5(str + secret)
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(str))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+//比较签名是否一致 固定耗时 避免时序攻击
+func SignEqual(a, b string) bool {
+	return hmac.Equal([]byte(a), []byte(b))
+}
+
+//生成带签名的param参数 用于服务间调用 返回值作为post请求的param字段提交
+//appKey secret 为对方服务分配的密钥对
+//control method 为要调用的控制器和方法
+func SignParam(appKey, secret, signType, control, method string, param map[string]interface{}) (string, error) {
+	if appKey == "" || secret == "" {
+		return "", errors.New("app_key和密钥不能为空")
+	}
+
+	if signType == "" {
+		signType = SignHmac
+	}
+
+	if param == nil {
+		param = make(map[string]interface{})
+	}
+
+	//服务端要求ip不为空 没有外部网卡时使用回环地址
+	ip := LocalIPV4()
+	if ip == "" {
+		ip = "127.0.0.1"
+	}
+
+	data := map[string]interface{}{
+		"app_key":   appKey,
+		"control":   control,
+		"method":    method,
+		"ip":        ip,
+		"timestamp": Time(),
+		"nonce":     UniqueId(),
+		"sign_type": signType,
+		"param":     param,
+	}
+
+	//经过一次json编解码 保证与服务端解析出的参数类型一致
+	b, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+
+	norm := make(map[string]interface{})
+	if err = json.Unmarshal(b, &norm); err != nil {
+		return "", err
+	}
+
+	normParam, _ := norm["param"].(map[string]interface{})
+	data["sign"] = Sign(signType, secret, SignString(norm, normParam))
+
+	b, err = json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+//按key排序拼接签名参数
+func signQuery(data map[string]interface{}) string {
+	key := make([]string, 0, len(data))
+	for k := range data {
+		key = append(key, k)
+	}
+	sort.Strings(key)
+
+	str := ""
+	for k, v := range key {
+		if k > 0 {
+			str += "&"
+		}
+
+		str += url.QueryEscape(v)
+		if data[v] != nil {
+			str += "=" + url.QueryEscape(signValue(data[v]))
+		}
+	}
+
+	return str
+}
+
+//签名参数值 小数按最短精确格式 复杂类型转为json字符串
+func signValue(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case int:
+		return strconv.Itoa(val)
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	default:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+}
@@ -0,0 +1,66 @@
+package commonFunc
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSignString(t *testing.T) {
+	common := map[string]interface{}{
+		"app_key": "k",
+		"nonce":   "n 1",
+		"sign":    "ignored",
+		"param":   "ignored",
+	}
+
+	//经过json解码 与服务端解析出的类型一致
+	param := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(`{"price":1.001,"count":3,"big":12345678901,"null":null,"empty":"","list":[1,"a"],"obj":{"b":1,"a":2}}`), &param); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "app_key=k&nonce=n+1&" +
+		"big=12345678901&count=3&empty=&list=%5B1%2C%22a%22%5D&null&obj=%7B%22a%22%3A2%2C%22b%22%3A1%7D&price=1.001"
+	if got := SignString(common, param); got != want {
+		t.Fatalf("SignString =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSign(t *testing.T) {
+	if got := Sign(SignMd5, "secret", "a=1"); got != Md5("a=1secret") {
+		t.Fatalf("md5 sign = %s", got)
+	}
+
+	//HMAC-SHA256("key", "The quick brown fox jumps over the lazy dog")
+	want := "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"
+	if got := Sign(SignHmac, "key", "The quick brown fox jumps over the lazy dog"); got != want {
+		t.Fatalf("hmac sign = %s", got)
+	}
+	if got := Sign("", "key", "The quick brown fox jumps over the lazy dog"); got != want {
+		t.Fatal("empty sign type should use hmac")
+	}
+}
+
+func TestSignParam(t *testing.T) {
+	if _, err := SignParam("", "secret", "", "order", "create", nil); err == nil {
+		t.Fatal("empty app_key should be rejected")
+	}
+
+	s, err := SignParam("k", "secret", "", "order", "create", map[string]interface{}{"price": 1.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := make(map[string]interface{})
+	if err = json.Unmarshal([]byte(s), &data); err != nil {
+		t.Fatal(err)
+	}
+	param, _ := data["param"].(map[string]interface{})
+
+	if data["sign_type"] != SignHmac || data["ip"] == "" {
+		t.Fatalf("SignParam = %s", s)
+	}
+	if !SignEqual(data["sign"].(string), Sign(SignHmac, "secret", SignString(data, param))) {
+		t.Fatalf("SignParam sign does not verify: %s", s)
+	}
+}
@@ -32,6 +32,7 @@ type confModify struct {
 	content []byte //文件内容
 	path    string
 	m       sync.Mutex
+	quiet   bool //文件暂时无法读取时跳过本次检查 不退出程序
 }
 
 //改进版检测 参数为配置文件名
@@ -56,11 +57,40 @@ func NewConFile(name string, pf func(interface{})) (*confModify, error) {
 	return conf, nil
 }
 
+//按完整路径监控文件 启动时不执行预设函数 仅在文件变化后执行
+//文件替换过程中暂时不存在时跳过 适用于证书等由外部程序更新的文件
+func NewFileMonitor(path string, pf func(interface{})) (*confModify, error) {
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	conf := &confModify{
+		path:    path,
+		modTime: fileInfo.ModTime().Unix(),
+		quiet:   true,
+	}
+
+	go func() {
+		for {
+			time.Sleep(1 * time.Second)
+			conf.ListenModify(pf)
+		}
+	}()
+
+	return conf, nil
+}
+
 //监控文件状态 变化时 执行预设函数
 func (c *confModify) ListenModify(pf func(interface{})) {
 	c.m.Lock()
+	defer c.m.Unlock()
+
 	file, err := os.Open(c.path)
 	if err != nil {
+		if c.quiet {
+			return
+		}
 		log.Fatal("获取文件出错")
 	}
 
@@ -68,6 +98,9 @@ func (c *confModify) ListenModify(pf func(interface{})) {
 
 	fileInfo, err := file.Stat()
 	if err != nil {
+		if c.quiet {
+			return
+		}
 		log.Fatal("获取文件基本信息出错")
 	}
 
@@ -82,6 +115,4 @@ func (c *confModify) ListenModify(pf func(interface{})) {
 		c.content = b2
 		pf(string(b2)) //调用函数
 	}
-
-	c.m.Unlock()
 }
@@ -0,0 +1,314 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/**
+数据库组件 基于database/sql 支持多个命名连接及读写分离
+需要在入口文件中引入对应的驱动 如:
+	import _ "github.com/go-sql-driver/mysql"
+	import _ "github.com/mattn/go-sqlite3"
+
+app.toml配置:
+	[db.default]
+	driver = "mysql"
+	master = "user:pass@tcp(127.0.0.1:3306)/test?charset=utf8mb4"
+	slaves = ["user:pass@tcp(127.0.0.2:3306)/test?charset=utf8mb4"]
+	maxOpen = 50
+	maxIdle = 10
+	maxLifetime = 3600
+	timeout = 5
+
+使用方法:
+	rows, err := ctx.DB().FetchAll("select id, name from user where id > ?", 10)
+	err = ctx.DB("order").Transaction(func(tx *db.Tx) error {
+		_, err := tx.Insert("order", map[string]interface{}{"uid": 1})
+		return err
+	})
+*/
+
+//单个数据库连接配置
+type Config struct {
+	Driver      string   `toml:"driver"`      //驱动名称 mysql sqlite3等
+	Master      string   `toml:"master"`      //主库dsn 写操作及事务使用
+	Slaves      []string `toml:"slaves"`      //从库dsn 读操作轮询使用 为空时读主库
+	MaxOpen     int      `toml:"maxOpen"`     //最大打开连接数 0不限制
+	MaxIdle     int      `toml:"maxIdle"`     //最大空闲连接数 0使用默认值2
+	MaxLifetime int64    `toml:"maxLifetime"` //连接最长复用时间 秒 0不限制
+	Timeout     int64    `toml:"timeout"`     //单次查询超时时间 秒 0不限制
+}
+
+//一个命名的数据库连接 包含主库及从库
+type DB struct {
+	name    string
+	master  *sql.DB
+	slaves  []*sql.DB
+	next    uint32 //从库轮询位置
+	timeout time.Duration
+	maxOpen int
+}
+
+//打开数据库连接 并不会立即建立连接 首次使用时才连接
+func Open(name string, conf Config) (*DB, error) {
+	if conf.Driver == "" {
+		return nil, errors.New("数据库" + name + "未配置driver")
+	}
+
+	if conf.Master == "" {
+		return nil, errors.New("数据库" + name + "未配置master")
+	}
+
+	db := &DB{
+		name:    name,
+		timeout: time.Duration(conf.Timeout) * time.Second,
+		maxOpen: conf.MaxOpen,
+	}
+
+	var err error
+	db.master, err = open(conf, conf.Master)
+	if err != nil {
+		return nil, errors.New("打开数据库" + name + "失败:" + err.Error())
+	}
+
+	for _, dsn := range conf.Slaves {
+		slave, err := open(conf, dsn)
+		if err != nil {
+			_ = db.Close()
+			return nil, errors.New("打开数据库" + name + "从库失败:" + err.Error())
+		}
+		db.slaves = append(db.slaves, slave)
+	}
+
+	return db, nil
+}
+
+func open(conf Config, dsn string) (*sql.DB, error) {
+	d, err := sql.Open(conf.Driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	//未配置时保持database/sql的默认值 SetMaxIdleConns(0)会导致每次查询都新建连接
+	if conf.MaxOpen > 0 {
+		d.SetMaxOpenConns(conf.MaxOpen)
+	}
+	if conf.MaxIdle > 0 {
+		d.SetMaxIdleConns(conf.MaxIdle)
+	}
+	if conf.MaxLifetime > 0 {
+		d.SetConnMaxLifetime(time.Duration(conf.MaxLifetime) * time.Second)
+	}
+
+	return d, nil
+}
+
+//连接名称
+func (this *DB) Name() string {
+	return this.name
+}
+
+//主库
+func (this *DB) Master() *sql.DB {
+	return this.master
+}
+
+//从库 轮询选择 未配置从库时返回主库
+func (this *DB) Slave() *sql.DB {
+	if len(this.slaves) == 0 {
+		return this.master
+	}
+
+	n := atomic.AddUint32(&this.next, 1)
+	return this.slaves[n%uint32(len(this.slaves))]
+}
+
+//执行写操作 使用主库
+func (this *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	ctx, cancel := this.context()
+	defer cancel()
+
+	return this.master.ExecContext(ctx, query, args...)
+}
+
+//查询 使用从库 rows需要调用方关闭
+//rows读取期间不受timeout限制 需要超时控制时使用QueryContext
+func (this *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return this.Slave().Query(query, args...)
+}
+
+//带上下文的查询 使用从库
+func (this *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return this.Slave().QueryContext(ctx, query, args...)
+}
+
+//查询全部数据 使用从库 NULL值转为空字符串
+func (this *DB) FetchAll(query string, args ...interface{}) ([]map[string]string, error) {
+	return fetchAll(this.Slave(), this.timeout, query, args...)
+}
+
+//查询一条数据 使用从库 无数据时返回nil
+func (this *DB) FetchOne(query string, args ...interface{}) (map[string]string, error) {
+	return fetchOne(this.Slave(), this.timeout, query, args...)
+}
+
+//查询全部数据 强制使用主库 用于写后立即读的场景
+func (this *DB) FetchAllMaster(query string, args ...interface{}) ([]map[string]string, error) {
+	return fetchAll(this.master, this.timeout, query, args...)
+}
+
+//插入一条数据 返回自增id
+func (this *DB) Insert(table string, data map[string]interface{}) (int64, error) {
+	return insert(this.master, this.timeout, table, data)
+}
+
+//更新数据 返回影响行数 where中使用?占位
+func (this *DB) Update(table string, data map[string]interface{}, where string, args ...interface{}) (int64, error) {
+	return update(this.master, this.timeout, table, data, where, args...)
+}
+
+//删除数据 返回影响行数 where中使用?占位
+func (this *DB) Delete(table string, where string, args ...interface{}) (int64, error) {
+	return remove(this.master, this.timeout, table, where, args...)
+}
+
+//在事务中执行fn fn返回错误或panic时回滚 否则提交
+func (this *DB) Transaction(fn func(tx *Tx) error) (err error) {
+	sqlTx, err := this.master.Begin()
+	if err != nil {
+		return err
+	}
+
+	tx := &Tx{tx: sqlTx, timeout: this.timeout}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = sqlTx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err = fn(tx); err != nil {
+		_ = sqlTx.Rollback()
+		return err
+	}
+
+	return sqlTx.Commit()
+}
+
+//关闭主库及从库连接
+func (this *DB) Close() error {
+	var err error
+	if this.master != nil {
+		err = this.master.Close()
+	}
+
+	for _, v := range this.slaves {
+		if e := v.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
+//单次查询的超时上下文
+func (this *DB) context() (context.Context, context.CancelFunc) {
+	return timeoutContext(this.timeout)
+}
+
+func timeoutContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+//多个命名连接的管理
+type Manager struct {
+	lock   sync.RWMutex
+	dbs    map[string]*DB
+	shards map[string]*Shard
+}
+
+//按配置打开全部连接
+func NewManager(conf map[string]Config) (*Manager, error) {
+	m := &Manager{dbs: make(map[string]*DB), shards: make(map[string]*Shard)}
+	for name, c := range conf {
+		db, err := Open(name, c)
+		if err != nil {
+			_ = m.Close()
+			return nil, err
+		}
+		m.dbs[name] = db
+	}
+
+	return m, nil
+}
+
+//按名称获取连接 name为空时使用default 不存在时返回nil
+func (this *Manager) Get(name string) *DB {
+	if this == nil {
+		return nil
+	}
+
+	if name == "" {
+		name = "default"
+	}
+
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+
+	return this.dbs[name]
+}
+
+//按配置设置分库分表 会替换原有的分片配置
+func (this *Manager) SetShards(conf map[string]ShardConfig) error {
+	shards := make(map[string]*Shard, len(conf))
+	for name, c := range conf {
+		s, err := newShard(name, c, this)
+		if err != nil {
+			return err
+		}
+		shards[name] = s
+	}
+
+	this.lock.Lock()
+	this.shards = shards
+	this.lock.Unlock()
+
+	return nil
+}
+
+//按逻辑表名获取分片 不存在时返回nil
+func (this *Manager) Shard(name string) *Shard {
+	if this == nil {
+		return nil
+	}
+
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+
+	return this.shards[name]
+}
+
+//关闭全部连接
+func (this *Manager) Close() error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	var err error
+	for _, v := range this.dbs {
+		if e := v.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	return err
+}
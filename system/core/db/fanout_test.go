@@ -0,0 +1,103 @@
+package db
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//记录同时执行的查询数的驱动 每次查询返回一行
+type countDriver struct {
+	running int64
+	max     int64
+}
+
+var counter = &countDriver{}
+
+func init() {
+	sql.Register("fanoutcount", counter)
+}
+
+func (this *countDriver) Open(name string) (driver.Conn, error) {
+	return countConn{}, nil
+}
+
+type countConn struct{}
+
+func (countConn) Prepare(query string) (driver.Stmt, error) { return countStmt{}, nil }
+func (countConn) Close() error                              { return nil }
+func (countConn) Begin() (driver.Tx, error)                 { return nil, driver.ErrSkip }
+
+type countStmt struct{}
+
+func (countStmt) Close() error  { return nil }
+func (countStmt) NumInput() int { return -1 }
+func (countStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(0), nil
+}
+
+func (countStmt) Query(args []driver.Value) (driver.Rows, error) {
+	n := atomic.AddInt64(&counter.running, 1)
+	for {
+		max := atomic.LoadInt64(&counter.max)
+		if n <= max || atomic.CompareAndSwapInt64(&counter.max, max, n) {
+			break
+		}
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	atomic.AddInt64(&counter.running, -1)
+
+	return &countRows{}, nil
+}
+
+type countRows struct{ done bool }
+
+func (*countRows) Columns() []string { return []string{"n"} }
+func (*countRows) Close() error      { return nil }
+func (this *countRows) Next(dest []driver.Value) error {
+	if this.done {
+		return io.EOF
+	}
+	this.done = true
+	dest[0] = int64(1)
+	return nil
+}
+
+func fanOutMax(t *testing.T, maxOpen int) int64 {
+	t.Helper()
+
+	m, err := NewManager(map[string]Config{"default": {Driver: "fanoutcount", Master: "x", MaxOpen: maxOpen}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	if err = m.SetShards(map[string]ShardConfig{"order": {Strategy: ShardMod, Count: 50, Table: "order_%d"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	atomic.StoreInt64(&counter.max, 0)
+	rows, err := m.Shard("order").FanOut(FanOutOption{}, "SELECT n FROM {table}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 50 {
+		t.Fatalf("FanOut returned %d rows, want 50", len(rows))
+	}
+
+	return atomic.LoadInt64(&counter.max)
+}
+
+//分片较多时 同时执行的查询数不超过maxOpen 未配置时不超过10
+func TestFanOutConcurrencyLimit(t *testing.T) {
+	if n := fanOutMax(t, 0); n > defaultFanOutLimit || n < 2 {
+		t.Fatalf("max concurrent queries = %d, want 2..%d", n, defaultFanOutLimit)
+	}
+	if n := fanOutMax(t, 3); n > 3 {
+		t.Fatalf("max concurrent queries = %d, want at most 3", n)
+	}
+}
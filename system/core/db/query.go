@@ -0,0 +1,205 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+//sql.DB 与 sql.Tx 共有的方法
+type executor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+//事务 读写均在同一个连接中执行
+type Tx struct {
+	tx      *sql.Tx
+	timeout time.Duration
+}
+
+//原始事务
+func (this *Tx) Tx() *sql.Tx {
+	return this.tx
+}
+
+func (this *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	ctx, cancel := timeoutContext(this.timeout)
+	defer cancel()
+
+	return this.tx.ExecContext(ctx, query, args...)
+}
+
+func (this *Tx) FetchAll(query string, args ...interface{}) ([]map[string]string, error) {
+	return fetchAll(this.tx, this.timeout, query, args...)
+}
+
+func (this *Tx) FetchOne(query string, args ...interface{}) (map[string]string, error) {
+	return fetchOne(this.tx, this.timeout, query, args...)
+}
+
+func (this *Tx) Insert(table string, data map[string]interface{}) (int64, error) {
+	return insert(this.tx, this.timeout, table, data)
+}
+
+func (this *Tx) Update(table string, data map[string]interface{}, where string, args ...interface{}) (int64, error) {
+	return update(this.tx, this.timeout, table, data, where, args...)
+}
+
+func (this *Tx) Delete(table string, where string, args ...interface{}) (int64, error) {
+	return remove(this.tx, this.timeout, table, where, args...)
+}
+
+func fetchAll(e executor, timeout time.Duration, query string, args ...interface{}) ([]map[string]string, error) {
+	ctx, cancel := timeoutContext(timeout)
+	defer cancel()
+
+	rows, err := e.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanRows(rows, 0)
+}
+
+func fetchOne(e executor, timeout time.Duration, query string, args ...interface{}) (map[string]string, error) {
+	ctx, cancel := timeoutContext(timeout)
+	defer cancel()
+
+	rows, err := e.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list, err := scanRows(rows, 1)
+	if err != nil || len(list) == 0 {
+		return nil, err
+	}
+
+	return list[0], nil
+}
+
+//读取结果集 limit大于0时最多读取limit行
+func scanRows(rows *sql.Rows, limit int) ([]map[string]string, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]sql.RawBytes, len(columns))
+	dest := make([]interface{}, len(columns))
+	for k := range values {
+		dest[k] = &values[k]
+	}
+
+	list := make([]map[string]string, 0)
+	for rows.Next() {
+		if err = rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		row := make(map[string]string, len(columns))
+		for k, v := range values {
+			row[columns[k]] = string(v)
+		}
+		list = append(list, row)
+
+		if limit > 0 && len(list) >= limit {
+			break
+		}
+	}
+
+	return list, rows.Err()
+}
+
+func insert(e executor, timeout time.Duration, table string, data map[string]interface{}) (int64, error) {
+	if len(data) == 0 {
+		return 0, errors.New("插入的数据不能为空")
+	}
+
+	keys := sortKeys(data)
+	args := make([]interface{}, 0, len(keys))
+	for _, k := range keys {
+		args = append(args, data[k])
+	}
+
+	query := "INSERT INTO " + table + " (" + strings.Join(keys, ", ") + ") VALUES (" + placeholders(len(keys)) + ")"
+
+	ctx, cancel := timeoutContext(timeout)
+	defer cancel()
+
+	res, err := e.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.LastInsertId()
+}
+
+func update(e executor, timeout time.Duration, table string, data map[string]interface{}, where string, whereArgs ...interface{}) (int64, error) {
+	if len(data) == 0 {
+		return 0, errors.New("更新的数据不能为空")
+	}
+
+	if strings.TrimSpace(where) == "" {
+		return 0, errors.New("更新数据必须指定条件")
+	}
+
+	keys := sortKeys(data)
+	sets := make([]string, 0, len(keys))
+	args := make([]interface{}, 0, len(keys)+len(whereArgs))
+	for _, k := range keys {
+		sets = append(sets, k+" = ?")
+		args = append(args, data[k])
+	}
+	args = append(args, whereArgs...)
+
+	query := "UPDATE " + table + " SET " + strings.Join(sets, ", ") + " WHERE " + where
+
+	ctx, cancel := timeoutContext(timeout)
+	defer cancel()
+
+	res, err := e.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func remove(e executor, timeout time.Duration, table string, where string, args ...interface{}) (int64, error) {
+	if strings.TrimSpace(where) == "" {
+		return 0, errors.New("删除数据必须指定条件")
+	}
+
+	ctx, cancel := timeoutContext(timeout)
+	defer cancel()
+
+	res, err := e.ExecContext(ctx, "DELETE FROM "+table+" WHERE "+where, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+//字段名排序 保证生成的sql稳定
+func sortKeys(data map[string]interface{}) []string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+//生成n个?占位符
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
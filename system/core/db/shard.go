@@ -0,0 +1,464 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"github.com/solaa51/gosab/system/core/commonFunc"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+分库分表
+每张逻辑表单独配置分片策略 由分片键计算出物理库和物理表
+sql中使用 {table} 表示物理表名
+
+app.toml配置:
+	[shards.order]
+	strategy = "crc32"    # crc32 按crc32取模 与commonFunc.Mod一致 | mod 按id取模 | range 按区间 | time 按时间
+	count = 10            # crc32 mod 策略的分片数
+	table = "order_%d"    # 物理表名格式 %d为分片序号 time策略使用%s为时间后缀
+	dbs = ["default"]     # 分库 按分片序号取模分配 为空时使用default
+	ranges = [1000000, 2000000]  # range策略 每个分片的上界(不含)
+	timeFormat = "Ym"     # time策略 后缀格式 Y按年 Ym按月 Ymd按天
+	timeStart = "2020-01-01"     # time策略 最早的分片时间 用于遍历全部分片
+
+使用方法:
+	rows, err := ctx.Shard("order").FetchAll(uid, "select * from {table} where uid = ?", uid)
+	rows, err := ctx.Shard("order").FanOut(db.FanOutOption{OrderBy: "id", Desc: true, Limit: 20}, "select * from {table} where status = ?", 1)
+*/
+
+const (
+	ShardCrc32 = "crc32"
+	ShardMod   = "mod"
+	ShardRange = "range"
+	ShardTime  = "time"
+)
+
+//sql中物理表名的占位
+const TablePlaceholder = "{table}"
+
+//单张逻辑表的分片配置
+type ShardConfig struct {
+	Strategy   string   `toml:"strategy"`
+	Count      int64    `toml:"count"`
+	Table      string   `toml:"table"`
+	DBs        []string `toml:"dbs"`
+	Ranges     []int64  `toml:"ranges"`
+	TimeFormat string   `toml:"timeFormat"`
+	TimeStart  string   `toml:"timeStart"`
+}
+
+//分片位置
+type Location struct {
+	Index int    //分片序号 time策略为从timeStart开始的序号
+	DB    string //物理库 即数据库连接名称
+	Table string //物理表
+}
+
+//一张逻辑表的分片
+type Shard struct {
+	name      string
+	conf      ShardConfig
+	manager   *Manager
+	layout    string    //time策略 go时间格式
+	timeStart time.Time //time策略 最早分片时间
+}
+
+//合并查询选项
+type FanOutOption struct {
+	Locations []Location //指定查询的分片 为空时查询全部分片
+	OrderBy   string     //合并后按该字段排序 数值字段按数值比较
+	Desc      bool       //是否倒序
+	Limit     int        //合并后最多返回的行数 0不限制
+}
+
+//校验分片配置
+func newShard(name string, conf ShardConfig, m *Manager) (*Shard, error) {
+	s := &Shard{name: name, conf: conf, manager: m}
+
+	if conf.Table == "" {
+		return nil, errors.New("分片" + name + "未配置table")
+	}
+
+	if len(s.conf.DBs) == 0 {
+		s.conf.DBs = []string{"default"}
+	}
+
+	switch conf.Strategy {
+	case ShardCrc32, ShardMod:
+		if conf.Count <= 0 {
+			return nil, errors.New("分片" + name + "的count必须大于0")
+		}
+	case ShardRange:
+		if len(conf.Ranges) == 0 {
+			return nil, errors.New("分片" + name + "未配置ranges")
+		}
+		if !sort.SliceIsSorted(conf.Ranges, func(i, j int) bool { return conf.Ranges[i] < conf.Ranges[j] }) {
+			return nil, errors.New("分片" + name + "的ranges必须从小到大")
+		}
+	case ShardTime:
+		switch conf.TimeFormat {
+		case "Y":
+			s.layout = "2006"
+		case "Ym", "":
+			s.layout = "200601"
+		case "Ymd":
+			s.layout = "20060102"
+		default:
+			return nil, errors.New("分片" + name + "不支持的timeFormat:" + conf.TimeFormat)
+		}
+
+		if conf.TimeStart != "" {
+			t, err := time.ParseInLocation("2006-01-02", conf.TimeStart, time.Local)
+			if err != nil {
+				return nil, errors.New("分片" + name + "的timeStart格式应为Y-m-d")
+			}
+			s.timeStart = s.truncate(t)
+		}
+	default:
+		return nil, errors.New("分片" + name + "不支持的策略:" + conf.Strategy)
+	}
+
+	return s, nil
+}
+
+//逻辑表名
+func (this *Shard) Name() string {
+	return this.name
+}
+
+//按分片键计算分片位置
+//crc32 支持整数和字符串 mod range 支持整数 time 支持time.Time和秒级时间戳
+func (this *Shard) Locate(key interface{}) (Location, error) {
+	switch this.conf.Strategy {
+	case ShardCrc32:
+		var str string
+		switch v := key.(type) {
+		case string:
+			str = v
+		default:
+			id, err := toInt64(key)
+			if err != nil {
+				return Location{}, err
+			}
+			str = strconv.FormatInt(id, 10)
+		}
+		return this.location(int(commonFunc.CrcMod(str, this.conf.Count))), nil
+	case ShardMod:
+		id, err := toInt64(key)
+		if err != nil {
+			return Location{}, err
+		}
+		idx := id % this.conf.Count
+		if idx < 0 {
+			idx = -idx
+		}
+		return this.location(int(idx)), nil
+	case ShardRange:
+		id, err := toInt64(key)
+		if err != nil {
+			return Location{}, err
+		}
+		idx := sort.Search(len(this.conf.Ranges), func(i int) bool { return id < this.conf.Ranges[i] })
+		if idx >= len(this.conf.Ranges) {
+			return Location{}, errors.New("分片键超出" + this.name + "的分片范围")
+		}
+		return this.location(idx), nil
+	default:
+		var t time.Time
+		switch v := key.(type) {
+		case time.Time:
+			t = v
+		default:
+			stamp, err := toInt64(key)
+			if err != nil {
+				return Location{}, err
+			}
+			t = time.Unix(stamp, 0)
+		}
+		return this.timeLocation(t), nil
+	}
+}
+
+//全部分片位置 time策略为timeStart至今的全部分片
+func (this *Shard) All() ([]Location, error) {
+	switch this.conf.Strategy {
+	case ShardCrc32, ShardMod:
+		list := make([]Location, 0, this.conf.Count)
+		for i := 0; i < int(this.conf.Count); i++ {
+			list = append(list, this.location(i))
+		}
+		return list, nil
+	case ShardRange:
+		list := make([]Location, 0, len(this.conf.Ranges))
+		for i := range this.conf.Ranges {
+			list = append(list, this.location(i))
+		}
+		return list, nil
+	default:
+		if this.timeStart.IsZero() {
+			return nil, errors.New("分片" + this.name + "未配置timeStart 无法遍历全部分片")
+		}
+		return this.Between(this.timeStart, time.Now()), nil
+	}
+}
+
+//time策略 时间区间内的分片位置 包含首尾
+func (this *Shard) Between(from, to time.Time) []Location {
+	list := make([]Location, 0)
+	if this.conf.Strategy != ShardTime {
+		return list
+	}
+
+	for t := this.truncate(from); !t.After(to); t = this.step(t) {
+		list = append(list, this.timeLocation(t))
+	}
+
+	return list
+}
+
+//按分片键获取数据库连接及物理表名
+func (this *Shard) DB(key interface{}) (*DB, string, error) {
+	loc, err := this.Locate(key)
+	if err != nil {
+		return nil, "", err
+	}
+
+	d, err := this.db(loc)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return d, loc.Table, nil
+}
+
+//按分片键查询 sql中使用{table}表示物理表
+func (this *Shard) FetchAll(key interface{}, query string, args ...interface{}) ([]map[string]string, error) {
+	d, table, err := this.DB(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.FetchAll(strings.Replace(query, TablePlaceholder, table, -1), args...)
+}
+
+//按分片键查询一条数据
+func (this *Shard) FetchOne(key interface{}, query string, args ...interface{}) (map[string]string, error) {
+	d, table, err := this.DB(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.FetchOne(strings.Replace(query, TablePlaceholder, table, -1), args...)
+}
+
+//按分片键执行写操作
+func (this *Shard) Exec(key interface{}, query string, args ...interface{}) (int64, error) {
+	d, table, err := this.DB(key)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := d.Exec(strings.Replace(query, TablePlaceholder, table, -1), args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+//并发查询多个分片 并合并结果
+//每个库同时执行的查询数不超过maxOpen 未配置时为10
+//未指定OrderBy时 按分片顺序合并
+func (this *Shard) FanOut(opt FanOutOption, query string, args ...interface{}) ([]map[string]string, error) {
+	locations := opt.Locations
+	if len(locations) == 0 {
+		var err error
+		locations, err = this.All()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	dbs := make([]*DB, len(locations))
+	for k, loc := range locations {
+		d, err := this.db(loc)
+		if err != nil {
+			return nil, err
+		}
+		dbs[k] = d
+	}
+
+	//按库限制并发 避免分片较多时占满连接
+	sems := make(map[*DB]chan struct{})
+	for _, d := range dbs {
+		if _, ok := sems[d]; !ok {
+			sems[d] = make(chan struct{}, d.fanOutLimit())
+		}
+	}
+
+	results := make([][]map[string]string, len(locations))
+	errs := make([]error, len(locations))
+
+	var wg sync.WaitGroup
+	for k, loc := range locations {
+		wg.Add(1)
+		go func(k int, d *DB, table string) {
+			defer wg.Done()
+
+			sem := sems[d]
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			results[k], errs[k] = d.FetchAll(strings.Replace(query, TablePlaceholder, table, -1), args...)
+		}(k, dbs[k], loc.Table)
+	}
+	wg.Wait()
+
+	rows := make([]map[string]string, 0)
+	for k := range results {
+		if errs[k] != nil {
+			return nil, errors.New("查询分片" + locations[k].Table + "失败:" + errs[k].Error())
+		}
+		rows = append(rows, results[k]...)
+	}
+
+	if opt.OrderBy != "" {
+		SortRows(rows, opt.OrderBy, opt.Desc)
+	}
+
+	if opt.Limit > 0 && len(rows) > opt.Limit {
+		rows = rows[:opt.Limit]
+	}
+
+	return rows, nil
+}
+
+//未配置maxOpen的库 合并查询时同时执行的查询数
+const defaultFanOutLimit = 10
+
+//合并查询时该库同时执行的查询数
+func (this *DB) fanOutLimit() int {
+	if this.maxOpen > 0 {
+		return this.maxOpen
+	}
+
+	return defaultFanOutLimit
+}
+
+//按字段排序结果集 两个值都是数值时按数值比较 否则按字符串比较
+func SortRows(rows []map[string]string, field string, desc bool) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := rows[i][field], rows[j][field]
+		fa, errA := strconv.ParseFloat(a, 64)
+		fb, errB := strconv.ParseFloat(b, 64)
+
+		if errA == nil && errB == nil {
+			if desc {
+				return fa > fb
+			}
+			return fa < fb
+		}
+
+		if desc {
+			return a > b
+		}
+		return a < b
+	})
+}
+
+func (this *Shard) location(idx int) Location {
+	return Location{
+		Index: idx,
+		DB:    this.conf.DBs[idx%len(this.conf.DBs)],
+		Table: fmt.Sprintf(this.conf.Table, idx),
+	}
+}
+
+func (this *Shard) timeLocation(t time.Time) Location {
+	idx := 0
+	if !this.timeStart.IsZero() {
+		idx = this.offset(this.timeStart, t)
+		if idx < 0 { //早于timeStart的时间 与首个分片同库
+			idx = 0
+		}
+	}
+
+	return Location{
+		Index: idx,
+		DB:    this.conf.DBs[idx%len(this.conf.DBs)],
+		Table: fmt.Sprintf(this.conf.Table, t.Format(this.layout)),
+	}
+}
+
+func (this *Shard) db(loc Location) (*DB, error) {
+	d := this.manager.Get(loc.DB)
+	if d == nil {
+		return nil, errors.New("分片" + this.name + "使用了未配置的数据库:" + loc.DB)
+	}
+
+	return d, nil
+}
+
+//time策略 时间对齐到分片的起点
+func (this *Shard) truncate(t time.Time) time.Time {
+	switch this.layout {
+	case "2006":
+		return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, t.Location())
+	case "20060102":
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	default:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	}
+}
+
+//time策略 from到t相差的分片数
+func (this *Shard) offset(from, t time.Time) int {
+	switch this.layout {
+	case "2006":
+		return t.Year() - from.Year()
+	case "20060102":
+		//按日历日期计算 不受夏令时影响
+		a := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+		b := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return int(b.Sub(a) / (24 * time.Hour))
+	default:
+		return (t.Year()-from.Year())*12 + int(t.Month()) - int(from.Month())
+	}
+}
+
+//time策略 下一个分片的起点
+func (this *Shard) step(t time.Time) time.Time {
+	switch this.layout {
+	case "2006":
+		return t.AddDate(1, 0, 0)
+	case "20060102":
+		return t.AddDate(0, 0, 1)
+	default:
+		return t.AddDate(0, 1, 0)
+	}
+}
+
+//分片键转换为整数
+func toInt64(key interface{}) (int64, error) {
+	switch v := key.(type) {
+	case int:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint32:
+		return int64(v), nil
+	case uint64:
+		return int64(v), nil
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	default:
+		return 0, fmt.Errorf("不支持的分片键类型:%T", key)
+	}
+}
@@ -0,0 +1,196 @@
+package db
+
+import (
+	"github.com/solaa51/gosab/system/core/commonFunc"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustShard(t *testing.T, conf ShardConfig) *Shard {
+	t.Helper()
+
+	s, err := newShard("order", conf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+//已按commonFunc.Mod分好的表 迁移到crc32策略后位置不能变化
+func TestLocateCrc32MatchesMod(t *testing.T) {
+	s := mustShard(t, ShardConfig{Strategy: ShardCrc32, Count: 10, Table: "order_%d"})
+
+	ids := []int64{0, 1, 9, 10, 123, 98765, 1 << 40}
+	for i := int64(0); i < 1000; i++ {
+		ids = append(ids, i*7919)
+	}
+
+	for _, id := range ids {
+		want := commonFunc.Mod(id)
+
+		for _, key := range []interface{}{id, int(id), strconv.FormatInt(id, 10)} {
+			loc, err := s.Locate(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(loc.Index) != want || loc.Table != "order_"+strconv.FormatInt(want, 10) {
+				t.Fatalf("Locate(%v) = %+v, commonFunc.Mod = %d", key, loc, want)
+			}
+		}
+	}
+}
+
+func TestLocateCrc32String(t *testing.T) {
+	s := mustShard(t, ShardConfig{Strategy: ShardCrc32, Count: 16, Table: "user_%d"})
+
+	loc, err := s.Locate("abc@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := commonFunc.CrcMod("abc@example.com", 16); int64(loc.Index) != want {
+		t.Fatalf("Index = %d, want %d", loc.Index, want)
+	}
+}
+
+func TestLocateMod(t *testing.T) {
+	s := mustShard(t, ShardConfig{Strategy: ShardMod, Count: 4, Table: "t_%d", DBs: []string{"a", "b"}})
+
+	cases := map[int64]Location{
+		0:  {Index: 0, DB: "a", Table: "t_0"},
+		5:  {Index: 1, DB: "b", Table: "t_1"},
+		7:  {Index: 3, DB: "b", Table: "t_3"},
+		-6: {Index: 2, DB: "a", Table: "t_2"},
+	}
+	for id, want := range cases {
+		loc, err := s.Locate(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loc != want {
+			t.Fatalf("Locate(%d) = %+v, want %+v", id, loc, want)
+		}
+	}
+
+	if _, err := s.Locate(1.5); err == nil {
+		t.Fatal("float key should be rejected")
+	}
+}
+
+func TestLocateRange(t *testing.T) {
+	s := mustShard(t, ShardConfig{Strategy: ShardRange, Ranges: []int64{100, 200}, Table: "t_%d"})
+
+	cases := map[int64]int{0: 0, 99: 0, 100: 1, 199: 1}
+	for id, want := range cases {
+		loc, err := s.Locate(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loc.Index != want {
+			t.Fatalf("Locate(%d).Index = %d, want %d", id, loc.Index, want)
+		}
+	}
+
+	if _, err := s.Locate(200); err == nil {
+		t.Fatal("key beyond the last range should be rejected")
+	}
+}
+
+func TestLocateTime(t *testing.T) {
+	s := mustShard(t, ShardConfig{Strategy: ShardTime, Table: "log_%s", TimeStart: "2020-11-01", DBs: []string{"a", "b"}})
+
+	at := time.Date(2021, 2, 15, 12, 0, 0, 0, time.Local)
+	want := Location{Index: 3, DB: "b", Table: "log_202102"}
+
+	loc, err := s.Locate(at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc != want {
+		t.Fatalf("Locate(time) = %+v, want %+v", loc, want)
+	}
+
+	loc, err = s.Locate(at.Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc != want {
+		t.Fatalf("Locate(unix) = %+v, want %+v", loc, want)
+	}
+
+	list := s.Between(time.Date(2020, 12, 31, 0, 0, 0, 0, time.Local), at)
+	tables := make([]string, 0, len(list))
+	for _, v := range list {
+		tables = append(tables, v.Table)
+	}
+	if got := strings.Join(tables, ","); got != "log_202012,log_202101,log_202102" {
+		t.Fatalf("Between = %s", got)
+	}
+}
+
+//分片序号按时间直接计算 与逐个分片累加的结果一致
+func TestTimeLocationIndex(t *testing.T) {
+	for _, format := range []string{"Y", "Ym", "Ymd"} {
+		s := mustShard(t, ShardConfig{Strategy: ShardTime, TimeFormat: format, Table: "log_%s", TimeStart: "2000-01-31"})
+
+		idx := 0
+		for at := s.timeStart; at.Year() < 2030; at = s.step(at) {
+			for _, t2 := range []time.Time{at, at.Add(13 * time.Hour), s.step(at).Add(-time.Second)} {
+				if loc := s.timeLocation(t2); loc.Index != idx {
+					t.Fatalf("%s: timeLocation(%s).Index = %d, want %d", format, t2, loc.Index, idx)
+				}
+			}
+			idx++
+		}
+
+		if loc := s.timeLocation(s.timeStart.AddDate(-1, 0, 0)); loc.Index != 0 {
+			t.Fatalf("%s: time before timeStart has index %d, want 0", format, loc.Index)
+		}
+	}
+
+	//按天分片的全部分片 序号连续
+	s := mustShard(t, ShardConfig{Strategy: ShardTime, TimeFormat: "Ymd", Table: "log_%s", TimeStart: "2000-01-01"})
+	all, err := s.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, loc := range all {
+		if loc.Index != k {
+			t.Fatalf("All()[%d].Index = %d", k, loc.Index)
+		}
+	}
+}
+
+func TestShardConfigErrors(t *testing.T) {
+	confs := []ShardConfig{
+		{Strategy: ShardCrc32, Table: "t_%d"},
+		{Strategy: ShardCrc32, Count: 2},
+		{Strategy: ShardRange, Ranges: []int64{200, 100}, Table: "t_%d"},
+		{Strategy: ShardTime, TimeFormat: "H", Table: "t_%s"},
+		{Strategy: ShardTime, TimeStart: "2020/01/01", Table: "t_%s"},
+		{Strategy: "hash", Count: 2, Table: "t_%d"},
+	}
+
+	for _, c := range confs {
+		if _, err := newShard("order", c, nil); err == nil {
+			t.Fatalf("config %+v should be rejected", c)
+		}
+	}
+}
+
+func TestSortRows(t *testing.T) {
+	rows := []map[string]string{{"id": "9"}, {"id": "10"}, {"id": "2"}}
+
+	SortRows(rows, "id", true)
+	if rows[0]["id"] != "10" || rows[2]["id"] != "2" {
+		t.Fatalf("numeric sort = %v", rows)
+	}
+
+	rows = []map[string]string{{"name": "b"}, {"name": "a"}, {"name": "c"}}
+	SortRows(rows, "name", false)
+	if rows[0]["name"] != "a" || rows[2]["name"] != "c" {
+		t.Fatalf("string sort = %v", rows)
+	}
+}
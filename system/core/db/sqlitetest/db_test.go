@@ -0,0 +1,178 @@
+package sqlitetest
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/solaa51/gosab/system/core/db"
+	_ "modernc.org/sqlite"
+)
+
+const userTable = "CREATE TABLE user (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, age INTEGER, note TEXT)"
+
+//主库和从库使用不同的sqlite文件 用于区分读写走向
+func openDB(t *testing.T) *db.DB {
+	t.Helper()
+
+	dir := t.TempDir()
+	d, err := db.Open("default", db.Config{
+		Driver:  "sqlite",
+		Master:  filepath.Join(dir, "master.db"),
+		Slaves:  []string{filepath.Join(dir, "slave.db")},
+		MaxOpen: 1,
+		Timeout: 5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = d.Close() })
+
+	if _, err = d.Master().Exec(userTable); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.Slave().Exec(userTable); err != nil {
+		t.Fatal(err)
+	}
+
+	return d
+}
+
+func TestInsertUpdateDelete(t *testing.T) {
+	d := openDB(t)
+
+	id, err := d.Insert("user", map[string]interface{}{"name": "tom", "age": 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 1 {
+		t.Fatalf("Insert id = %d, want 1", id)
+	}
+
+	n, err := d.Update("user", map[string]interface{}{"age": 21}, "id = ?", id)
+	if err != nil || n != 1 {
+		t.Fatalf("Update = %d, %v", n, err)
+	}
+
+	rows, err := d.FetchAllMaster("SELECT id, name, age, note FROM user WHERE id = ?", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0]["name"] != "tom" || rows[0]["age"] != "21" || rows[0]["note"] != "" {
+		t.Fatalf("FetchAllMaster = %v", rows)
+	}
+
+	if _, err = d.Update("user", map[string]interface{}{"age": 1}, ""); err == nil {
+		t.Fatal("Update without where should be rejected")
+	}
+
+	n, err = d.Delete("user", "id = ?", id)
+	if err != nil || n != 1 {
+		t.Fatalf("Delete = %d, %v", n, err)
+	}
+}
+
+//写入主库 读取从库 从库没有同步时读不到
+func TestReadWriteSplit(t *testing.T) {
+	d := openDB(t)
+
+	if _, err := d.Insert("user", map[string]interface{}{"name": "master"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Slave().Exec("INSERT INTO user (name) VALUES ('slave')"); err != nil {
+		t.Fatal(err)
+	}
+
+	row, err := d.FetchOne("SELECT name FROM user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row["name"] != "slave" {
+		t.Fatalf("FetchOne read %v, want the slave row", row)
+	}
+
+	rows, err := d.FetchAllMaster("SELECT name FROM user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0]["name"] != "master" {
+		t.Fatalf("FetchAllMaster read %v, want the master row", rows)
+	}
+
+	row, err = d.FetchOne("SELECT name FROM user WHERE id = ?", 100)
+	if err != nil || row != nil {
+		t.Fatalf("FetchOne without rows = %v, %v", row, err)
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	d := openDB(t)
+
+	err := d.Transaction(func(tx *db.Tx) error {
+		_, err := tx.Insert("user", map[string]interface{}{"name": "commit"})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rollback := errors.New("rollback")
+	err = d.Transaction(func(tx *db.Tx) error {
+		if _, err := tx.Insert("user", map[string]interface{}{"name": "error"}); err != nil {
+			return err
+		}
+
+		//事务内可以读到未提交的数据
+		row, err := tx.FetchOne("SELECT name FROM user WHERE name = ?", "error")
+		if err != nil || row == nil {
+			t.Fatalf("FetchOne in tx = %v, %v", row, err)
+		}
+
+		return rollback
+	})
+	if err != rollback {
+		t.Fatalf("Transaction error = %v, want %v", err, rollback)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("panic should be re-raised after rollback")
+			}
+		}()
+
+		_ = d.Transaction(func(tx *db.Tx) error {
+			_, _ = tx.Insert("user", map[string]interface{}{"name": "panic"})
+			panic("boom")
+		})
+	}()
+
+	rows, err := d.FetchAllMaster("SELECT name FROM user ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0]["name"] != "commit" {
+		t.Fatalf("rows after transactions = %v, want only the committed row", rows)
+	}
+}
+
+//未配置maxIdle时保留空闲连接 内存库的建表与后续查询使用同一连接
+func TestMemoryDefaultPool(t *testing.T) {
+	d, err := db.Open("memory", db.Config{Driver: "sqlite", Master: ":memory:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	if _, err = d.Master().Exec("CREATE TABLE u (id INTEGER PRIMARY KEY, name TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.Insert("u", map[string]interface{}{"name": "tom"}); err != nil {
+		t.Fatal(err)
+	}
+
+	row, err := d.FetchOne("SELECT name FROM u")
+	if err != nil || row["name"] != "tom" {
+		t.Fatalf("FetchOne = %v, %v", row, err)
+	}
+}
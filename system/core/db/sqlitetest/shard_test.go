@@ -0,0 +1,111 @@
+package sqlitetest
+
+import (
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/solaa51/gosab/system/core/commonFunc"
+	"github.com/solaa51/gosab/system/core/db"
+)
+
+//order_0~order_3 按分片序号交替放在a、b两个库
+func openShard(t *testing.T) (*db.Manager, *db.Shard) {
+	t.Helper()
+
+	dir := t.TempDir()
+	m, err := db.NewManager(map[string]db.Config{
+		"a": {Driver: "sqlite", Master: filepath.Join(dir, "a.db")},
+		"b": {Driver: "sqlite", Master: filepath.Join(dir, "b.db")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = m.Close() })
+
+	err = m.SetShards(map[string]db.ShardConfig{
+		"order": {Strategy: db.ShardCrc32, Count: 4, Table: "order_%d", DBs: []string{"a", "b"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := m.Shard("order")
+	all, err := s.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, loc := range all {
+		if _, err = m.Get(loc.DB).Exec("CREATE TABLE " + loc.Table + " (id INTEGER PRIMARY KEY, uid INTEGER, amount INTEGER)"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return m, s
+}
+
+func TestShardRouting(t *testing.T) {
+	m, s := openShard(t)
+
+	for uid := int64(1); uid <= 20; uid++ {
+		n, err := s.Exec(uid, "INSERT INTO {table} (id, uid, amount) VALUES (?, ?, ?)", uid, uid, uid*10)
+		if err != nil || n != 1 {
+			t.Fatalf("Exec(%d) = %d, %v", uid, n, err)
+		}
+	}
+
+	for uid := int64(1); uid <= 20; uid++ {
+		//物理位置与commonFunc.CrcMod一致
+		idx := commonFunc.CrcMod(strconv.FormatInt(uid, 10), 4)
+		name := []string{"a", "b"}[idx%2]
+
+		row, err := m.Get(name).FetchOne("SELECT uid FROM order_"+strconv.FormatInt(idx, 10)+" WHERE uid = ?", uid)
+		if err != nil || row == nil {
+			t.Fatalf("uid %d not found in %s.order_%d: %v", uid, name, idx, err)
+		}
+
+		row, err = s.FetchOne(uid, "SELECT amount FROM {table} WHERE uid = ?", uid)
+		if err != nil || row["amount"] != strconv.FormatInt(uid*10, 10) {
+			t.Fatalf("FetchOne(%d) = %v, %v", uid, row, err)
+		}
+	}
+}
+
+func TestFanOut(t *testing.T) {
+	_, s := openShard(t)
+
+	for uid := int64(1); uid <= 20; uid++ {
+		if _, err := s.Exec(uid, "INSERT INTO {table} (id, uid, amount) VALUES (?, ?, ?)", uid, uid, uid*10); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rows, err := s.FanOut(db.FanOutOption{}, "SELECT uid FROM {table}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 20 {
+		t.Fatalf("FanOut returned %d rows, want 20", len(rows))
+	}
+
+	rows, err = s.FanOut(db.FanOutOption{OrderBy: "amount", Desc: true, Limit: 3}, "SELECT uid, amount FROM {table} WHERE amount >= ?", 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[0]["uid"] != "20" || rows[1]["uid"] != "19" || rows[2]["uid"] != "18" {
+		t.Fatalf("FanOut ordered = %v", rows)
+	}
+
+	loc, err := s.Locate(int64(7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err = s.FanOut(db.FanOutOption{Locations: []db.Location{loc}}, "SELECT uid FROM {table} WHERE uid = ?", 7)
+	if err != nil || len(rows) != 1 {
+		t.Fatalf("FanOut with locations = %v, %v", rows, err)
+	}
+
+	if _, err = s.FanOut(db.FanOutOption{}, "SELECT missing FROM {table}"); err == nil {
+		t.Fatal("FanOut should report a failing shard")
+	}
+}
@@ -0,0 +1,61 @@
+package graceful
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+type connKey struct{}
+
+//将连接放入请求的context 便于按请求调整超时
+func connContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, c)
+}
+
+//获取请求所在的连接
+func Conn(r *http.Request) net.Conn {
+	c, _ := r.Context().Value(connKey{}).(net.Conn)
+	return c
+}
+
+/**
+调整本次请求所在连接的读写超时 从调用时开始计算
+0保持服务默认值 小于0取消超时 用于长轮询、websocket、上传等
+读超时需在读取请求体之前设置 同一连接的下一个请求会重新设置读超时 写超时只在服务配置了writeTimeout时恢复
+只支持HTTP/1.x HTTP/2的连接由多个请求共用 修改会影响其他请求 返回错误且不做调整
+*/
+func SetDeadline(r *http.Request, read, write time.Duration) error {
+	if r.ProtoMajor != 1 {
+		return errors.New("HTTP/2的连接由多个请求共用 不能按请求调整超时")
+	}
+
+	c := Conn(r)
+	if c == nil {
+		return errors.New("未找到请求所在的连接")
+	}
+
+	if read != 0 {
+		if err := c.SetReadDeadline(deadline(read)); err != nil {
+			return err
+		}
+	}
+
+	if write != 0 {
+		if err := c.SetWriteDeadline(deadline(write)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func deadline(d time.Duration) time.Time {
+	if d < 0 {
+		return time.Time{}
+	}
+
+	return time.Now().Add(d)
+}
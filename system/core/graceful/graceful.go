@@ -2,51 +2,86 @@ package graceful
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	slog "github.com/solaa51/gosab/system/core/log"
-	"log"
 	"net"
 	"net/http"
 	"os"
-	"os/exec"
 	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 )
 
 /**
 用于启动http服务和支持热重启
+可同时监听http、https及unix socket 热重启时全部监听传递给新进程
 */
 
+//监听类型
+const (
+	KindHttp  = "http"
+	KindHttps = "https"
+	KindUnix  = "unix"
+)
+
+//一个监听
+type ListenerConfig struct {
+	Kind string //http https unix
+	Addr string //tcp为监听地址 如:80 unix为socket文件路径
+}
+
+//启动配置
+type Config struct {
+	Listeners     []ListenerConfig //监听列表 热重启时按类型和地址对应继承的文件描述符
+	TLSConfig     *tls.Config      //https监听使用的tls配置 证书通过GetCertificate提供
+	HttpsRedirect bool             //同时存在https监听时 http监听只做跳转到https
+
+	ReadTimeout       time.Duration //读取整个请求的最大时长 0不限制
+	WriteTimeout      time.Duration //写响应的最大时长 0不限制
+	IdleTimeout       time.Duration //keep-alive连接的最大空闲时间 0使用ReadTimeout
+	ReadHeaderTimeout time.Duration //读取请求头的最大时长 0使用ReadTimeout
+	MaxHeaderBytes    int           //请求头最大字节数 0使用默认1MB
+
+	MaxConns     int           //全部监听合计最大同时打开的连接数 0不限制
+	MaxRequests  int           //全部监听合计最大同时处理的请求数 0不限制
+	QueueTimeout time.Duration //请求数已满时的最长等待时间 超时返回503 0直接返回
+
+	RestartTimeout time.Duration //热重启时等待新进程就绪的最长时间 默认30秒 超时则继续使用原进程
+}
+
 type graceful struct {
+	servers []*server
+	Log     *slog.NLog //用于 记录日志
+
+	restartTimeout time.Duration //热重启时等待新进程就绪的最长时间
+}
+
+//一个监听对应的服务
+type server struct {
+	ListenerConfig
 	Server   *http.Server //http服务server配置实例
-	Listener net.Listener
-	Log      *slog.NLog //用于 记录日志
+	Listener net.Listener //原始监听 热重启时传递给新进程
 
-	HttpsPem string //https ssl配置
-	HttpsKey string //https ssl配置
+	serveListener net.Listener //实际提供服务的监听 可能包装了连接数限制
 }
 
 func (this *graceful) start() {
-	//将http服务放到一个goroutine中
+	//将http服务放到goroutine中
 	//不能将http服务放到 main goroutine中 给接收信号让开路
-	go func() {
-		var err error
-		if this.HttpsPem != "" && this.HttpsKey != "" {
-			err = this.Server.ServeTLS(this.Listener, this.HttpsPem, this.HttpsKey)
-		} else {
-			err = this.Server.Serve(this.Listener)
-		}
-
-		if err != nil {
-			this.Log.Error("启动http服务失败：" + err.Error())
-			return
-		}
-	}()
+	addrs := make([]string, 0, len(this.servers))
+	for _, s := range this.servers {
+		go this.serve(s)
+		addrs = append(addrs, s.Kind+"://"+s.Addr)
+	}
 
-	//服务已启动
-	xx := fmt.Sprintf("服务进程为：%d, 您可用\nkill -HUP %d, 重启或升级服务\n", os.Getpid(), os.Getpid())
+	//服务已启动 热重启时通知父进程
+	notifyReady()
+	xx := fmt.Sprintf("服务进程为：%d, 监听：%s, 您可用\nkill -HUP %d, 重启或升级服务\n", os.Getpid(), strings.Join(addrs, " "), os.Getpid())
 	this.Log.Info(xx)
 
 	this.singleHandle()
@@ -54,29 +89,67 @@ func (this *graceful) start() {
 	return
 }
 
+func (this *graceful) serve(s *server) {
+	var err error
+	if s.Kind == KindHttps {
+		err = s.Server.ServeTLS(s.serveListener, "", "") //证书由TLSConfig提供
+	} else {
+		err = s.Server.Serve(s.serveListener)
+	}
+
+	if err != nil && err != http.ErrServerClosed {
+		this.Log.Error("启动" + s.Kind + "服务失败：" + err.Error())
+	}
+}
+
 //重启服务
 func (this *graceful) restart() error {
-	ln, ok := this.Listener.(*net.TCPListener)
-	if !ok {
-		return errors.New("转换tcp listener失败")
+	files := make([]*os.File, 0, len(this.servers)+1)
+	listeners := make([]inheritedListener, 0, len(this.servers))
+	for _, s := range this.servers {
+		ln, ok := s.Listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			closeFiles(files)
+			return errors.New("转换listener失败：" + s.Addr)
+		}
+
+		ff, err := ln.File()
+		if err != nil {
+			closeFiles(files)
+			return errors.New("获取socket文件描述符失败：" + s.Addr)
+		}
+		files = append(files, ff)
+		listeners = append(listeners, inheritedListener{Kind: s.Kind, Addr: s.Addr, Fd: 2 + len(files)})
 	}
 
-	ff, err := ln.File()
+	//就绪通知管道 写端传递给新进程 放在监听之后
+	r, w, err := os.Pipe()
 	if err != nil {
-		return errors.New("获取socket文件描述符失败")
+		closeFiles(files)
+		return errors.New("创建就绪通知管道失败：" + err.Error())
 	}
+	files = append(files, w)
 
-	cmd := exec.Command(os.Args[0], []string{"-g"}...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.ExtraFiles = []*os.File{ff} //重用原有的socket文件描述符
+	//按原有的启动参数、环境变量及工作目录启动新进程
+	cmd := restartCommand(listenersEnv(listeners), envReadyFd+"="+strconv.Itoa(2+len(files)))
+	cmd.ExtraFiles = files //重用原有的socket文件描述符 依次为3、4、5...
 
 	err = cmd.Start()
+	closeFiles(files) //新进程已持有副本
 	if err != nil {
+		_ = r.Close()
 		return errors.New("启动新进程报错了：" + err.Error())
 	}
 
-	return nil
+	this.Log.Info("新进程已启动 等待就绪：" + strconv.Itoa(cmd.Process.Pid))
+
+	return waitReady(cmd, r, this.restartTimeout)
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		_ = f.Close()
+	}
 }
 
 //监听主进程的信号
@@ -86,66 +159,188 @@ func (this *graceful) singleHandle() {
 	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 	for {
 		sig := <-ch
-		ctx, _ := context.WithTimeout(context.Background(), time.Second*20)
 		switch sig {
 		case syscall.SIGINT, syscall.SIGTERM:
 			this.Log.Info("关闭服务")
 			signal.Stop(ch)
-			_ = this.Server.Shutdown(ctx) //平滑关闭原有连接
+			this.shutdown()   //平滑关闭原有连接
+			this.removeUnix() //不再有进程使用 删除socket文件
+			slog.Close()      //写入剩余的异步日志
 			return
 		case syscall.SIGHUP:
 			this.Log.Info("热重启服务启动")
 			fmt.Println("收到信号：", sig)
 			err := this.restart()
-			if err != nil {
-				this.Log.Error("热重启服务失败" + err.Error())
-				log.Fatal("热重启服务失败", err)
+			if err != nil { //新进程未能就绪 继续使用当前进程提供服务
+				this.Log.Error("热重启服务失败 继续提供服务：" + err.Error())
+				continue
 			}
 
-			_ = this.Server.Shutdown(ctx) //平滑关闭原有连接
+			this.shutdown() //平滑关闭原有连接
 			this.Log.Info("热重启完成")
+			slog.Close() //写入剩余的异步日志
 			return
 		}
 	}
 }
 
+//平滑关闭全部服务的原有连接 最多等待20秒
+func (this *graceful) shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, s := range this.servers {
+		wg.Add(1)
+		go func(s *server) {
+			defer wg.Done()
+			_ = s.Server.Shutdown(ctx)
+		}(s)
+	}
+	wg.Wait()
+}
+
+func (this *graceful) removeUnix() {
+	for _, s := range this.servers {
+		if s.Kind == KindUnix {
+			_ = os.Remove(s.Addr)
+		}
+	}
+}
+
 //启动
-func Start(addr string, log *slog.NLog, mux http.Handler, httpsPem string, httpsKey string, gracefulReload bool) error {
-	var ln net.Listener
-	var err error
-	if gracefulReload { //启动命令中包含参数 热重启时，从socket文件描述符 重新启动一个监听
-		//当存在监听socket时 socket的文件描述符就是3 所以从本进程的3号文件描述符 恢复socket监听
-		f := os.NewFile(3, "")
-		ln, err = net.FileListener(f)
-		if err != nil {
-			return err
+func Start(conf Config, log *slog.NLog, mux http.Handler, gracefulReload bool) error {
+	if len(conf.Listeners) == 0 {
+		return errors.New("未配置监听地址")
+	}
+
+	handler := mux
+	if conf.MaxRequests > 0 {
+		handler = limitHandler(mux, conf.MaxRequests, conf.QueueTimeout)
+	}
+
+	var sem chan struct{}
+	if conf.MaxConns > 0 {
+		sem = make(chan struct{}, conf.MaxConns)
+	}
+
+	httpsAddr := ""
+	for _, lc := range conf.Listeners {
+		if lc.Kind == KindHttps {
+			httpsAddr = lc.Addr
+			break
 		}
-	} else {
-		ln, err = net.Listen("tcp", addr)
+	}
+
+	gf := &graceful{
+		Log:            log,
+		restartTimeout: conf.RestartTimeout,
+	}
+	if gf.restartTimeout <= 0 {
+		gf.restartTimeout = 30 * time.Second
+	}
+
+	inherited := newInheritance(gracefulReload)
+	for i, lc := range conf.Listeners {
+		ln, err := listen(lc, inherited, i)
 		if err != nil {
+			gf.closeListeners()
 			return err
 		}
-	}
 
-	server := &http.Server{
-		Addr:              addr,
-		Handler:           mux,
-		TLSConfig:         nil,
-		ReadTimeout:       time.Second * 30, //读取包括请求体的整个请求的最大时长
-		WriteTimeout:      time.Second * 30, //写响应允许的最大时长 30秒程序未能输出 则退出http连接
-		IdleTimeout:       time.Second * 30, //当开启了保持活动状态（keep-alive）时允许的最大空闲时间
-		ReadHeaderTimeout: time.Second * 2,  //允许读请求头的最大时长
-	}
+		serveListener := ln
+		if sem != nil {
+			serveListener = newLimitListener(ln, sem)
+		}
 
-	gf := &graceful{
-		Log:      log,
-		Server:   server,
-		Listener: ln,
-		HttpsPem: httpsPem,
-		HttpsKey: httpsKey,
+		if lc.Kind == KindHttps && conf.TLSConfig == nil {
+			gf.closeListeners()
+			_ = ln.Close()
+			return errors.New("https监听未配置证书")
+		}
+
+		h := handler
+		if lc.Kind == KindHttp && conf.HttpsRedirect && httpsAddr != "" {
+			h = redirectHandler(httpsAddr)
+		}
+
+		gf.servers = append(gf.servers, &server{
+			ListenerConfig: lc,
+			Listener:       ln,
+			serveListener:  serveListener,
+			Server: &http.Server{
+				Addr:              lc.Addr,
+				Handler:           h,
+				TLSConfig:         conf.TLSConfig,
+				ReadTimeout:       conf.ReadTimeout,       //读取包括请求体的整个请求的最大时长
+				WriteTimeout:      conf.WriteTimeout,      //写响应允许的最大时长 超时未能输出 则退出http连接
+				IdleTimeout:       conf.IdleTimeout,       //当开启了保持活动状态（keep-alive）时允许的最大空闲时间
+				ReadHeaderTimeout: conf.ReadHeaderTimeout, //允许读请求头的最大时长
+				MaxHeaderBytes:    conf.MaxHeaderBytes,
+				ConnContext:       connContext, //按路由调整超时时使用
+			},
+		})
 	}
 
+	inherited.closeUnused()
+
 	gf.start()
 
 	return nil
 }
+
+//创建监听 热重启时从继承的文件描述符恢复
+func listen(lc ListenerConfig, inherited *inheritance, i int) (net.Listener, error) {
+	if fd, ok := inherited.fd(lc, i); ok { //新增的监听没有可继承的文件描述符 重新监听
+		f := os.NewFile(uintptr(fd), "")
+		ln, err := net.FileListener(f)
+		_ = f.Close() //FileListener会复制文件描述符
+		return ln, err
+	}
+
+	switch lc.Kind {
+	case KindUnix:
+		_ = os.Remove(lc.Addr) //清理上次异常退出残留的socket文件
+		ln, err := net.Listen("unix", lc.Addr)
+		if err != nil {
+			return nil, err
+		}
+		//关闭时保留socket文件 热重启时新进程继续使用 退出时再删除
+		ln.(*net.UnixListener).SetUnlinkOnClose(false)
+		return ln, nil
+	case KindHttp, KindHttps:
+		return net.Listen("tcp", lc.Addr)
+	default:
+		return nil, errors.New("不支持的监听类型：" + lc.Kind)
+	}
+}
+
+//启动失败时关闭已创建的监听
+func (this *graceful) closeListeners() {
+	for _, s := range this.servers {
+		_ = s.Listener.Close()
+	}
+}
+
+//http跳转到https 保留原host和请求路径
+func redirectHandler(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+
+		//GET、HEAD以外的请求使用308 保持请求方法和请求体
+		code := http.StatusMovedPermanently
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			code = http.StatusPermanentRedirect
+		}
+
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), code)
+	})
+}
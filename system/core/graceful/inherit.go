@@ -0,0 +1,181 @@
+package graceful
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+/**
+热重启时按原样启动新进程
+可执行文件的绝对路径、启动参数、环境变量及工作目录均在启动时记录
+继承的监听通过环境变量GOSAB_LISTENERS说明类型、地址及文件描述符 新进程按类型和地址对应
+*/
+
+const (
+	envListeners = "GOSAB_LISTENERS"  //继承的监听 json格式
+	envListenFds = "GOSAB_LISTEN_FDS" //旧版本 继承的文件描述符数量 按顺序对应
+	reloadFlag   = "-g"               //热重启参数
+)
+
+//启动时的运行信息
+var (
+	startExe  = executable(startDir)
+	startArgs = append([]string{}, os.Args[1:]...)
+	startEnv  = os.Environ()
+	startDir  = workDir()
+)
+
+//传递给新进程的监听信息
+type inheritedListener struct {
+	Kind string `json:"kind"`
+	Addr string `json:"addr"`
+	Fd   int    `json:"fd"`
+}
+
+//启动时的可执行文件路径 不解析符号链接 热重启执行该路径
+//通过替换文件或切换符号链接升级时 执行的是新版本 升级检测也应监视该路径
+func Executable() string {
+	return startExe
+}
+
+//按启动目录解析os.Args[0] 只有命令名时从PATH查找
+func executable(dir string) string {
+	p := os.Args[0]
+	if !strings.Contains(p, string(filepath.Separator)) {
+		lp, err := exec.LookPath(p)
+		if err != nil {
+			lp, _ = os.Executable()
+			return lp
+		}
+		p = lp
+	}
+
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(dir, p)
+	}
+
+	return filepath.Clean(p)
+}
+
+func workDir() string {
+	dir, _ := os.Getwd()
+	return dir
+}
+
+//生成启动新进程的命令 extra为附加的环境变量
+func restartCommand(extra ...string) *exec.Cmd {
+	//去掉原有的热重启参数 并放在最前面 避免被非flag参数截断
+	args := []string{reloadFlag}
+	for i, a := range startArgs {
+		//"--"之后均为普通参数 原样保留
+		if a == "--" {
+			args = append(args, startArgs[i:]...)
+			break
+		}
+		if isReloadFlag(a) {
+			continue
+		}
+		args = append(args, a)
+	}
+
+	//去掉上次热重启传入的变量
+	env := make([]string, 0, len(startEnv)+len(extra))
+	for _, e := range startEnv {
+		if strings.HasPrefix(e, envListeners+"=") || strings.HasPrefix(e, envListenFds+"=") || strings.HasPrefix(e, envReadyFd+"=") {
+			continue
+		}
+		env = append(env, e)
+	}
+	env = append(env, extra...)
+
+	cmd := exec.Command(startExe, args...)
+	cmd.Env = env
+	cmd.Dir = startDir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd
+}
+
+//是否为热重启参数 只匹配-g --g -g=... --g=... 不带"-"的g、g=true等是普通参数
+func isReloadFlag(a string) bool {
+	if !strings.HasPrefix(a, "-") {
+		return false
+	}
+
+	name := strings.TrimPrefix(strings.TrimPrefix(a, "-"), "-")
+	if i := strings.Index(name, "="); i >= 0 {
+		name = name[:i]
+	}
+
+	return name == strings.TrimPrefix(reloadFlag, "-")
+}
+
+//监听信息的环境变量
+func listenersEnv(list []inheritedListener) string {
+	b, _ := json.Marshal(list)
+	return envListeners + "=" + string(b)
+}
+
+//继承自父进程的监听
+type inheritance struct {
+	listeners  []inheritedListener
+	positional int //旧版本父进程传递的文件描述符数量
+	used       map[int]bool
+}
+
+func newInheritance(gracefulReload bool) *inheritance {
+	this := &inheritance{used: make(map[int]bool)}
+	if !gracefulReload {
+		return this
+	}
+
+	if v := os.Getenv(envListeners); v != "" {
+		_ = json.Unmarshal([]byte(v), &this.listeners)
+		return this
+	}
+
+	//旧版本父进程 没有监听信息时只传递了一个
+	this.positional = 1
+	if n, err := strconv.Atoi(os.Getenv(envListenFds)); err == nil {
+		this.positional = n
+	}
+
+	return this
+}
+
+//第i个监听可继承的文件描述符
+func (this *inheritance) fd(lc ListenerConfig, i int) (int, bool) {
+	for _, l := range this.listeners {
+		if l.Kind == lc.Kind && l.Addr == lc.Addr && !this.used[l.Fd] {
+			this.used[l.Fd] = true
+			return l.Fd, true
+		}
+	}
+
+	if i < this.positional {
+		this.used[3+i] = true
+		return 3 + i, true
+	}
+
+	return 0, false
+}
+
+//关闭配置中已不存在的监听
+func (this *inheritance) closeUnused() {
+	for _, l := range this.listeners {
+		if !this.used[l.Fd] {
+			_ = os.NewFile(uintptr(l.Fd), "").Close()
+		}
+	}
+
+	for i := 0; i < this.positional; i++ {
+		if !this.used[3+i] {
+			_ = os.NewFile(uintptr(3+i), "").Close()
+		}
+	}
+}
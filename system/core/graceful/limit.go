@@ -0,0 +1,74 @@
+package graceful
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/solaa51/gosab/system/core/limiter"
+)
+
+//限制同时打开的连接数 达到上限后不再accept 新连接在内核队列中等待
+//多个监听共用sem时 限制的是合计连接数
+type limitListener struct {
+	net.Listener
+	sem  chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+func newLimitListener(ln net.Listener, sem chan struct{}) net.Listener {
+	return &limitListener{Listener: ln, sem: sem, done: make(chan struct{})}
+}
+
+func (this *limitListener) Accept() (net.Conn, error) {
+	select {
+	case this.sem <- struct{}{}:
+	case <-this.done: //关闭时不再等待名额
+		return nil, http.ErrServerClosed
+	}
+
+	c, err := this.Listener.Accept()
+	if err != nil {
+		<-this.sem
+		return nil, err
+	}
+
+	return &limitConn{Conn: c, release: func() { <-this.sem }}, nil
+}
+
+func (this *limitListener) Close() error {
+	err := this.Listener.Close()
+	this.once.Do(func() { close(this.done) })
+	return err
+}
+
+//连接关闭时归还名额 多次Close只归还一次
+type limitConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (this *limitConn) Close() error {
+	err := this.Conn.Close()
+	this.once.Do(this.release)
+	return err
+}
+
+//限制同时处理的请求数 等待queueTimeout仍无空位时直接返回503
+func limitHandler(h http.Handler, n int, queueTimeout time.Duration) http.Handler {
+	cl := limiter.NewLimiter(n)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !cl.Acquire(queueTimeout) {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "服务繁忙 请稍后再试", http.StatusServiceUnavailable)
+			return
+		}
+		defer cl.ReleaseConn()
+
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,63 @@
+package graceful
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+//热重启时 新进程通过此文件描述符通知父进程已开始提供服务
+const envReadyFd = "GOSAB_READY_FD"
+
+//新进程已开始提供服务 通知父进程 非热重启启动时不做处理
+func notifyReady() {
+	fd, err := strconv.Atoi(os.Getenv(envReadyFd))
+	if err != nil {
+		return
+	}
+	_ = os.Unsetenv(envReadyFd) //之后再次热重启时不会传递给下一个进程
+
+	f := os.NewFile(uintptr(fd), "ready")
+	_, _ = f.Write([]byte{1})
+	_ = f.Close()
+}
+
+/**
+等待新进程就绪
+新进程写入数据表示已开始提供服务 新进程退出时管道关闭读到EOF
+超时或失败时结束新进程 父进程继续提供服务
+*/
+func waitReady(cmd *exec.Cmd, r *os.File, timeout time.Duration) error {
+	done := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 1)
+		_, err := r.Read(buf)
+		done <- err
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case err = <-done:
+		if err == io.EOF {
+			err = errors.New("新进程未就绪即退出")
+		}
+	case <-timer.C:
+		err = errors.New("等待新进程就绪超时")
+	}
+	_ = r.Close()
+
+	if err != nil {
+		_ = cmd.Process.Kill()
+		go func() {
+			_ = cmd.Wait() //回收已结束的进程
+		}()
+	}
+
+	return err
+}
@@ -99,7 +99,7 @@ func NewHttpServer(addr string, mux *http.ServeMux) error {
 func (h *HotUpSocket) listenSignal() {
 
 	//创建一个阻塞信号 channel
-	signals := make(chan os.Signal)
+	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGHUP, syscall.SIGTERM)
 	for sig := range signals {
 		if sig == syscall.SIGTERM{ //可接收处理信号的 关闭信号 kill pid命令
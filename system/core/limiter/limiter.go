@@ -1,28 +1,86 @@
 package limiter
 
-//流控方案
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrTimeout = errors.New("等待可用连接超时")
+
+//并发数限制 获取与释放均为原子操作
 type ConnLimiter struct {
-	conCurrentCon int      //当前可用连接数
-	bucket        chan int //池子
+	bucket chan struct{} //池子 容量为最大并发数
 }
 
 //限流器
 func NewLimiter(num int) *ConnLimiter {
+	if num <= 0 {
+		num = 1
+	}
+
 	return &ConnLimiter{
-		conCurrentCon: num,
-		bucket:        make(chan int, num),
+		bucket: make(chan struct{}, num),
 	}
 }
 
+//立即获取 无可用名额时返回false
 func (cl *ConnLimiter) GetConn() bool {
-	if len(cl.bucket) >= cl.conCurrentCon {
+	select {
+	case cl.bucket <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+//等待获取 超过timeout仍无可用名额时返回false
+func (cl *ConnLimiter) Acquire(timeout time.Duration) bool {
+	if cl.GetConn() {
+		return true
+	}
+	if timeout <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case cl.bucket <- struct{}{}:
+		return true
+	case <-timer.C:
 		return false
 	}
+}
 
-	cl.bucket <- 1
-	return true
+//等待获取 直到ctx结束
+func (cl *ConnLimiter) AcquireContext(ctx context.Context) error {
+	select {
+	case cl.bucket <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return ErrTimeout
+		}
+		return ctx.Err()
+	}
 }
 
+//释放名额 需与获取成功一一对应
 func (cl *ConnLimiter) ReleaseConn() {
-	<-cl.bucket
+	select {
+	case <-cl.bucket:
+	default:
+	}
+}
+
+//当前已使用的名额
+func (cl *ConnLimiter) InUse() int {
+	return len(cl.bucket)
+}
+
+//最大并发数
+func (cl *ConnLimiter) Cap() int {
+	return cap(cl.bucket)
 }
@@ -0,0 +1,186 @@
+package limiter
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+//按key限流 返回是否放行 拒绝时返回建议的重试等待时间
+type Limiter interface {
+	Allow(key string) (bool, time.Duration)
+}
+
+//长时间未访问的key定期清理
+const sweepInterval = time.Minute
+
+/**
+令牌桶 每秒生成rate个令牌 最多积攒burst个 允许一定的突发请求
+*/
+type TokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	if rate <= 0 {
+		rate = 1
+	}
+	if burst <= 0 {
+		burst = int(rate)
+		if burst < 1 {
+			burst = 1
+		}
+	}
+
+	return &TokenBucket{
+		rate:      rate,
+		burst:     float64(burst),
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+func (this *TokenBucket) Allow(key string) (bool, time.Duration) {
+	now := time.Now()
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.sweep(now)
+
+	b, ok := this.buckets[key]
+	if !ok {
+		b = &bucket{tokens: this.burst, last: now}
+		this.buckets[key] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * this.rate
+	if b.tokens > this.burst {
+		b.tokens = this.burst
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	return false, time.Duration((1 - b.tokens) / this.rate * float64(time.Second))
+}
+
+//清理已回满的令牌桶 调用方需持有锁
+func (this *TokenBucket) sweep(now time.Time) {
+	if now.Sub(this.lastSweep) < sweepInterval {
+		return
+	}
+	this.lastSweep = now
+
+	full := time.Duration(this.burst / this.rate * float64(time.Second))
+	for k, b := range this.buckets {
+		if now.Sub(b.last) > full {
+			delete(this.buckets, k)
+		}
+	}
+}
+
+/**
+滑动窗口计数 window内最多limit次请求
+按上一个固定窗口的计数加权估算 计数保存在Store中 使用共享的Store时多台机器共用配额
+Store出错时放行 并通过OnError通知
+*/
+type SlidingWindow struct {
+	limit  int64
+	window time.Duration
+	store  Store
+
+	OnError func(err error)
+}
+
+func NewSlidingWindow(limit int64, window time.Duration) *SlidingWindow {
+	return NewSlidingWindowStore(limit, window, NewMemoryStore())
+}
+
+func NewSlidingWindowStore(limit int64, window time.Duration, store Store) *SlidingWindow {
+	if limit <= 0 {
+		limit = 1
+	}
+	if window <= 0 {
+		window = time.Second
+	}
+
+	return &SlidingWindow{
+		limit:  limit,
+		window: window,
+		store:  store,
+	}
+}
+
+func (this *SlidingWindow) Allow(key string) (bool, time.Duration) {
+	now := time.Now().UnixNano()
+	w := int64(this.window)
+	index := now / w
+	elapsed := now % w
+
+	curKey := key + ":" + strconv.FormatInt(index, 10)
+	prevKey := key + ":" + strconv.FormatInt(index-1, 10)
+
+	//先计数再按计数结果判断 同时到达的请求拿到不同的计数 不会因读到相同的计数而全部放行
+	//计数保留两个窗口 供下一个窗口加权使用
+	cur, err := this.store.Incr(curKey, 2*this.window)
+	if err != nil {
+		this.fail(err)
+		return true, 0
+	}
+
+	counts, err := this.store.Get(prevKey)
+	if err != nil {
+		this.fail(err)
+		return true, 0
+	}
+
+	ok, wait := slide(counts[0], cur-1, this.limit, elapsed, w)
+	if !ok {
+		//被拒绝的请求不占用配额
+		if err = this.store.Decr(curKey, 2*this.window); err != nil {
+			this.fail(err)
+		}
+	}
+
+	return ok, wait
+}
+
+func (this *SlidingWindow) fail(err error) {
+	if this.OnError != nil {
+		this.OnError(err)
+	}
+}
+
+//按加权计数判断是否放行 cur为当前窗口中本次请求之前的计数
+//elapsed为当前窗口已过去的时间 w为窗口长度 均为纳秒
+func slide(prev, cur, limit, elapsed, w int64) (bool, time.Duration) {
+	weight := float64(w-elapsed) / float64(w)
+	if float64(prev)*weight+float64(cur)+1 <= float64(limit) {
+		return true, 0
+	}
+
+	//上一窗口的权重随时间下降 计算何时能腾出一个名额 最迟到下一个窗口
+	wait := w - elapsed
+	if prev > 0 && cur < limit {
+		t := int64(float64(w)*float64(prev+cur+1-limit)/float64(prev)) - elapsed
+		if t > 0 && t < wait {
+			wait = t
+		}
+	}
+
+	return false, time.Duration(wait)
+}
@@ -0,0 +1,178 @@
+package limiter
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	AlgorithmToken  = "token"
+	AlgorithmWindow = "window"
+
+	KeyIp         = "ip"
+	KeyAppKey     = "app_key"
+	KeyController = "controller"
+	KeyMethod     = "method"
+)
+
+/**
+限流规则 app.toml中配置
+
+	[[limit]]
+	key = "ip"             #限流维度 ip app_key controller method 可用,组合 如"app_key,method"
+	algorithm = "token"    #token令牌桶(默认) window滑动窗口
+	rate = 10              #令牌桶 每period秒生成的令牌数
+	period = 1             #令牌桶 rate对应的秒数 默认1 如rate=1 period=60即每分钟1次
+	burst = 20             #令牌桶 容量 默认与rate相同
+
+	[[limit]]
+	key = "app_key"
+	algorithm = "window"
+	limit = 1000           #滑动窗口 窗口内允许的请求数
+	window = 60            #滑动窗口 窗口长度 秒 默认1
+	controller = "order"   #只对指定控制器生效 空为全部 不区分大小写
+	method = "Create"      #只对指定方法生效 空为全部 不区分大小写
+*/
+type Rule struct {
+	Key        string `toml:"key"`
+	Algorithm  string `toml:"algorithm"`
+	Rate       int64  `toml:"rate"`
+	Period     int64  `toml:"period"`
+	Burst      int    `toml:"burst"`
+	Limit      int64  `toml:"limit"`
+	Window     int64  `toml:"window"`
+	Controller string `toml:"controller"`
+	Method     string `toml:"method"`
+}
+
+//请求的限流维度取值
+type Keys struct {
+	Ip         string
+	AppKey     string
+	Controller string
+	Method     string
+}
+
+//一组限流规则 依次检查 任一规则拒绝即拒绝
+type Set struct {
+	rules []*rule
+}
+
+type rule struct {
+	Rule
+	keys    []string
+	limiter Limiter
+}
+
+//window算法的规则使用store计数 store为空时使用进程内存储
+//使用共享存储时 各机器的规则需保持一致 计数key按规则顺序区分
+//onError用于通知store的错误 此时请求会被放行
+func NewSet(rules []Rule, store Store, onError func(err error)) (*Set, error) {
+	if store == nil {
+		store = NewMemoryStore()
+	}
+
+	s := &Set{}
+	for i, r := range rules {
+		keys := strings.Split(r.Key, ",")
+		for j, k := range keys {
+			k = strings.TrimSpace(k)
+			switch k {
+			case KeyIp, KeyAppKey, KeyController, KeyMethod:
+			default:
+				return nil, fmt.Errorf("第%d条限流规则 不支持的key:%s", i+1, k)
+			}
+			keys[j] = k
+		}
+
+		var l Limiter
+		switch r.Algorithm {
+		case "", AlgorithmToken:
+			if r.Rate <= 0 {
+				return nil, fmt.Errorf("第%d条限流规则 rate需大于0", i+1)
+			}
+			period := r.Period
+			if period <= 0 {
+				period = 1
+			}
+			burst := r.Burst
+			if burst <= 0 {
+				burst = int(r.Rate)
+			}
+			l = NewTokenBucket(float64(r.Rate)/float64(period), burst)
+		case AlgorithmWindow:
+			if r.Limit <= 0 {
+				return nil, fmt.Errorf("第%d条限流规则 limit需大于0", i+1)
+			}
+			window := r.Window
+			if window <= 0 {
+				window = 1
+			}
+			sw := NewSlidingWindowStore(r.Limit, time.Duration(window)*time.Second, store)
+			sw.OnError = onError
+			l = sw
+		default:
+			return nil, fmt.Errorf("第%d条限流规则 不支持的algorithm:%s", i+1, r.Algorithm)
+		}
+
+		s.rules = append(s.rules, &rule{Rule: r, keys: keys, limiter: l})
+	}
+
+	return s, nil
+}
+
+//检查请求是否放行 拒绝时返回建议的重试等待时间
+//规则所需的维度取值为空时 该规则不生效 如未验签的请求没有app_key
+func (this *Set) Allow(k Keys) (bool, time.Duration) {
+	if this == nil {
+		return true, 0
+	}
+
+	for i, r := range this.rules {
+		//ctx.Method首字母为大写 配置中写成小写也能匹配
+		if r.Controller != "" && !strings.EqualFold(r.Controller, k.Controller) {
+			continue
+		}
+		if r.Method != "" && !strings.EqualFold(r.Method, k.Method) {
+			continue
+		}
+
+		key, ok := r.key(i, k)
+		if !ok {
+			continue
+		}
+
+		if ok, wait := r.limiter.Allow(key); !ok {
+			return false, wait
+		}
+	}
+
+	return true, 0
+}
+
+//拼接限流key
+func (this *rule) key(i int, k Keys) (string, bool) {
+	var b strings.Builder
+	b.WriteString(fmt.Sprint(i))
+	for _, name := range this.keys {
+		var v string
+		switch name {
+		case KeyIp:
+			v = k.Ip
+		case KeyAppKey:
+			v = k.AppKey
+		case KeyController:
+			v = k.Controller
+		case KeyMethod:
+			v = k.Controller + "/" + k.Method
+		}
+		if v == "" {
+			return "", false
+		}
+		b.WriteString("|")
+		b.WriteString(v)
+	}
+
+	return b.String(), true
+}
@@ -0,0 +1,138 @@
+package limiter
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	StoreMemory = "memory"
+	StoreRedis  = "redis"
+)
+
+//滑动窗口的计数存储 多台机器使用同一个共享存储即可共用配额
+type Store interface {
+	Get(keys ...string) ([]int64, error)               //获取计数 不存在的key为0
+	Incr(key string, ttl time.Duration) (int64, error) //计数加1 并设置过期时间 返回加1后的计数
+	Decr(key string, ttl time.Duration) error          //计数减1 用于撤销被拒绝请求的计数
+}
+
+/**
+计数存储配置 app.toml中[limitStore]
+type为redis时 window算法的规则在所有机器间共享配额 令牌桶(token 默认算法)仍为单机
+
+	[limitStore]
+	type = "redis"
+	addr = "127.0.0.1:6379"
+	password = ""
+	db = 0
+	prefix = "gosab:limit:"  #key前缀 默认gosab:limit:
+	poolSize = 10            #最大空闲连接数 默认10
+	timeout = 200            #连接及读写超时 毫秒 默认200
+*/
+type StoreConfig struct {
+	Type     string `toml:"type"`
+	Addr     string `toml:"addr"`
+	Password string `toml:"password"`
+	DB       int    `toml:"db"`
+	Prefix   string `toml:"prefix"`
+	PoolSize int    `toml:"poolSize"`
+	Timeout  int64  `toml:"timeout"`
+}
+
+func NewStore(conf StoreConfig) (Store, error) {
+	switch conf.Type {
+	case "", StoreMemory:
+		return NewMemoryStore(), nil
+	case StoreRedis:
+		if conf.Addr == "" {
+			return nil, fmt.Errorf("redis存储需配置addr")
+		}
+		return NewRedisStore(conf), nil
+	default:
+		return nil, fmt.Errorf("不支持的限流存储类型:%s", conf.Type)
+	}
+}
+
+//进程内存储
+type MemoryStore struct {
+	mu        sync.Mutex
+	items     map[string]*memoryItem
+	lastSweep time.Time
+}
+
+type memoryItem struct {
+	n      int64
+	expire time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		items:     make(map[string]*memoryItem),
+		lastSweep: time.Now(),
+	}
+}
+
+func (this *MemoryStore) Get(keys ...string) ([]int64, error) {
+	now := time.Now()
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	ret := make([]int64, len(keys))
+	for i, k := range keys {
+		if item, ok := this.items[k]; ok && now.Before(item.expire) {
+			ret[i] = item.n
+		}
+	}
+
+	return ret, nil
+}
+
+func (this *MemoryStore) Incr(key string, ttl time.Duration) (int64, error) {
+	now := time.Now()
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.sweep(now)
+
+	item, ok := this.items[key]
+	if !ok || !now.Before(item.expire) {
+		item = &memoryItem{}
+		this.items[key] = item
+	}
+	item.n++
+	item.expire = now.Add(ttl)
+
+	return item.n, nil
+}
+
+func (this *MemoryStore) Decr(key string, ttl time.Duration) error {
+	now := time.Now()
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if item, ok := this.items[key]; ok && now.Before(item.expire) && item.n > 0 {
+		item.n--
+		item.expire = now.Add(ttl)
+	}
+
+	return nil
+}
+
+//清理过期的计数 调用方需持有锁
+func (this *MemoryStore) sweep(now time.Time) {
+	if now.Sub(this.lastSweep) < sweepInterval {
+		return
+	}
+	this.lastSweep = now
+
+	for k, item := range this.items {
+		if !now.Before(item.expire) {
+			delete(this.items, k)
+		}
+	}
+}
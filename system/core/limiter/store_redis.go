@@ -0,0 +1,266 @@
+package limiter
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+/**
+基于redis协议的计数存储 只用到AUTH SELECT MGET INCR DECR PEXPIRE
+兼容redis及实现了以上命令的服务
+*/
+type RedisStore struct {
+	conf    StoreConfig
+	timeout time.Duration
+	pool    chan *redisConn
+}
+
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+//redis返回的错误
+type redisError string
+
+func (this redisError) Error() string {
+	return "redis: " + string(this)
+}
+
+func NewRedisStore(conf StoreConfig) *RedisStore {
+	if conf.Prefix == "" {
+		conf.Prefix = "gosab:limit:"
+	}
+	if conf.PoolSize <= 0 {
+		conf.PoolSize = 10
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = 200
+	}
+
+	return &RedisStore{
+		conf:    conf,
+		timeout: time.Duration(conf.Timeout) * time.Millisecond,
+		pool:    make(chan *redisConn, conf.PoolSize),
+	}
+}
+
+func (this *RedisStore) Get(keys ...string) ([]int64, error) {
+	args := make([]string, 0, len(keys)+1)
+	args = append(args, "MGET")
+	for _, k := range keys {
+		args = append(args, this.conf.Prefix+k)
+	}
+
+	replies, err := this.do(args)
+	if err != nil {
+		return nil, err
+	}
+
+	list, ok := replies[0].([]interface{})
+	if !ok || len(list) != len(keys) {
+		return nil, fmt.Errorf("redis: MGET返回格式错误")
+	}
+
+	ret := make([]int64, len(keys))
+	for i, v := range list {
+		if s, ok := v.(string); ok {
+			ret[i], _ = strconv.ParseInt(s, 10, 64)
+		}
+	}
+
+	return ret, nil
+}
+
+func (this *RedisStore) Incr(key string, ttl time.Duration) (int64, error) {
+	key = this.conf.Prefix + key
+	ms := strconv.FormatInt(int64(ttl/time.Millisecond), 10)
+
+	replies, err := this.do([]string{"INCR", key}, []string{"PEXPIRE", key, ms})
+	if err != nil {
+		return 0, err
+	}
+
+	n, ok := replies[0].(int64)
+	if !ok {
+		return 0, fmt.Errorf("redis: INCR返回格式错误")
+	}
+
+	return n, nil
+}
+
+//与PEXPIRE一起发送 计数在两条命令之间过期时 也不会留下没有过期时间的key
+func (this *RedisStore) Decr(key string, ttl time.Duration) error {
+	key = this.conf.Prefix + key
+	ms := strconv.FormatInt(int64(ttl/time.Millisecond), 10)
+
+	_, err := this.do([]string{"DECR", key}, []string{"PEXPIRE", key, ms})
+
+	return err
+}
+
+//以管道方式发送多条命令 任一命令返回错误时整体返回错误
+func (this *RedisStore) do(cmds ...[]string) ([]interface{}, error) {
+	c, err := this.get()
+	if err != nil {
+		return nil, err
+	}
+
+	replies, err := c.do(this.timeout, cmds...)
+	if err != nil {
+		//命令本身的错误不影响连接 可继续复用
+		if _, ok := err.(redisError); ok {
+			this.put(c)
+		} else {
+			_ = c.conn.Close()
+		}
+		return nil, err
+	}
+
+	this.put(c)
+	return replies, nil
+}
+
+//从连接池获取连接 没有空闲连接时新建
+func (this *RedisStore) get() (*redisConn, error) {
+	select {
+	case c := <-this.pool:
+		return c, nil
+	default:
+	}
+
+	conn, err := net.DialTimeout("tcp", this.conf.Addr, this.timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &redisConn{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+
+	var cmds [][]string
+	if this.conf.Password != "" {
+		cmds = append(cmds, []string{"AUTH", this.conf.Password})
+	}
+	if this.conf.DB > 0 {
+		cmds = append(cmds, []string{"SELECT", strconv.Itoa(this.conf.DB)})
+	}
+	if len(cmds) > 0 {
+		if _, err = c.do(this.timeout, cmds...); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+//归还连接 连接池已满时关闭
+func (this *RedisStore) put(c *redisConn) {
+	select {
+	case this.pool <- c:
+	default:
+		_ = c.conn.Close()
+	}
+}
+
+//关闭空闲连接
+func (this *RedisStore) Close() error {
+	for {
+		select {
+		case c := <-this.pool:
+			_ = c.conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+func (this *redisConn) do(timeout time.Duration, cmds ...[]string) ([]interface{}, error) {
+	_ = this.conn.SetDeadline(time.Now().Add(timeout))
+
+	for _, args := range cmds {
+		this.w.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+		for _, a := range args {
+			this.w.WriteString("$" + strconv.Itoa(len(a)) + "\r\n" + a + "\r\n")
+		}
+	}
+	if err := this.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	//读完全部回复后再返回错误 保持连接上的请求与回复对应
+	var firstErr error
+	replies := make([]interface{}, len(cmds))
+	for i := range cmds {
+		reply, err := this.read()
+		if err != nil {
+			if _, ok := err.(redisError); !ok {
+				return nil, err
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		replies[i] = reply
+	}
+
+	return replies, firstErr
+}
+
+//读取一条RESP回复
+func (this *redisConn) read() (interface{}, error) {
+	line, err := this.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errors.New("redis: 协议格式错误")
+	}
+	line = line[:len(line)-2]
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err = io.ReadFull(this.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		list := make([]interface{}, n)
+		for i := range list {
+			if list[i], err = this.read(); err != nil {
+				if _, ok := err.(redisError); !ok {
+					return nil, err
+				}
+			}
+		}
+		return list, nil
+	}
+
+	return nil, errors.New("redis: 未知的回复类型")
+}
@@ -0,0 +1,330 @@
+package limiter
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//本地的redis服务 只实现RedisStore用到的命令
+type fakeRedis struct {
+	ln       net.Listener
+	password string
+
+	mu    sync.Mutex
+	items map[string]*fakeItem //key为 库序号:key
+}
+
+type fakeItem struct {
+	n      int64
+	expire time.Time
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fakeRedis{ln: ln, password: password, items: make(map[string]*fakeItem)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+
+	return f
+}
+
+func (this *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	authed := this.password == ""
+	db := "0"
+
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		cmd := strings.ToUpper(args[0])
+		switch {
+		case cmd == "AUTH":
+			authed = len(args) == 2 && args[1] == this.password
+			if authed {
+				w.WriteString("+OK\r\n")
+			} else {
+				w.WriteString("-WRONGPASS invalid password\r\n")
+			}
+		case !authed:
+			w.WriteString("-NOAUTH Authentication required.\r\n")
+		case cmd == "SELECT":
+			db = args[1]
+			w.WriteString("+OK\r\n")
+		case cmd == "MGET":
+			w.WriteString("*" + strconv.Itoa(len(args)-1) + "\r\n")
+			for _, k := range args[1:] {
+				if n, ok := this.get(db + ":" + k); ok {
+					v := strconv.FormatInt(n, 10)
+					w.WriteString("$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n")
+				} else {
+					w.WriteString("$-1\r\n")
+				}
+			}
+		case cmd == "INCR" || cmd == "DECR":
+			delta := int64(1)
+			if cmd == "DECR" {
+				delta = -1
+			}
+			w.WriteString(":" + strconv.FormatInt(this.add(db+":"+args[1], delta), 10) + "\r\n")
+		case cmd == "PEXPIRE":
+			ms, _ := strconv.ParseInt(args[2], 10, 64)
+			w.WriteString(":" + strconv.Itoa(this.expire(db+":"+args[1], time.Duration(ms)*time.Millisecond)) + "\r\n")
+		default:
+			w.WriteString("-ERR unknown command '" + args[0] + "'\r\n")
+		}
+
+		//管道中的命令读完后再一起回复
+		if r.Buffered() == 0 {
+			if err = w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+//读取一条命令 格式为bulk string数组
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, errors.New("inline commands are not supported")
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil || n <= 0 {
+		return nil, errors.New("bad array length")
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		line, err = r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err = io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+
+	return args, nil
+}
+
+func (this *fakeRedis) live(key string) *fakeItem {
+	item, ok := this.items[key]
+	if ok && !item.expire.IsZero() && time.Now().After(item.expire) {
+		delete(this.items, key)
+		return nil
+	}
+
+	return item
+}
+
+func (this *fakeRedis) get(key string) (int64, bool) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if item := this.live(key); item != nil {
+		return item.n, true
+	}
+
+	return 0, false
+}
+
+func (this *fakeRedis) add(key string, delta int64) int64 {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	item := this.live(key)
+	if item == nil {
+		item = &fakeItem{}
+		this.items[key] = item
+	}
+	item.n += delta
+
+	return item.n
+}
+
+func (this *fakeRedis) expire(key string, ttl time.Duration) int {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	item := this.live(key)
+	if item == nil {
+		return 0
+	}
+	item.expire = time.Now().Add(ttl)
+
+	return 1
+}
+
+func TestRedisStore(t *testing.T) {
+	f := newFakeRedis(t, "")
+	defer f.ln.Close()
+
+	s := NewRedisStore(StoreConfig{Addr: f.ln.Addr().String()})
+	defer s.Close()
+
+	for want := int64(1); want <= 3; want++ {
+		n, err := s.Incr("a", time.Minute)
+		if err != nil || n != want {
+			t.Fatalf("Incr = %d, %v, want %d", n, err, want)
+		}
+	}
+	if err := s.Decr("a", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	counts, err := s.Get("a", "missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts[0] != 2 || counts[1] != 0 {
+		t.Fatalf("Get = %v, want [2 0]", counts)
+	}
+
+	//key带默认前缀 并设置了过期时间
+	f.mu.Lock()
+	item := f.items["0:gosab:limit:a"]
+	f.mu.Unlock()
+	if item == nil || item.expire.IsZero() {
+		t.Fatalf("stored item = %+v, want a prefixed key with a ttl", item)
+	}
+
+	//过期后重新计数
+	if _, err = s.Incr("short", 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n, _ := s.Incr("short", time.Minute); n != 1 {
+		t.Fatalf("Incr after expire = %d, want 1", n)
+	}
+}
+
+func TestRedisStoreAuthAndSelect(t *testing.T) {
+	f := newFakeRedis(t, "secret")
+	defer f.ln.Close()
+
+	bad := NewRedisStore(StoreConfig{Addr: f.ln.Addr().String(), Password: "wrong"})
+	defer bad.Close()
+	if _, err := bad.Incr("a", time.Minute); err == nil {
+		t.Fatal("Incr with a wrong password should fail")
+	}
+
+	db0 := NewRedisStore(StoreConfig{Addr: f.ln.Addr().String(), Password: "secret"})
+	defer db0.Close()
+	db2 := NewRedisStore(StoreConfig{Addr: f.ln.Addr().String(), Password: "secret", DB: 2})
+	defer db2.Close()
+
+	if _, err := db0.Incr("a", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := db2.Incr("a", time.Minute); err != nil || n != 1 {
+		t.Fatalf("Incr in db 2 = %d, %v, want a separate counter", n, err)
+	}
+}
+
+//两台机器共用redis 并发请求时放行总数不超过limit
+func TestRedisStoreSharedQuota(t *testing.T) {
+	f := newFakeRedis(t, "")
+	defer f.ln.Close()
+
+	rules := []Rule{{Key: KeyAppKey, Algorithm: AlgorithmWindow, Limit: 50, Window: 60}}
+
+	var sets [2]*Set
+	for i := range sets {
+		store := NewRedisStore(StoreConfig{Addr: f.ln.Addr().String(), Timeout: 2000})
+		defer store.Close()
+
+		set, err := NewSet(rules, store, func(err error) { t.Error(err) })
+		if err != nil {
+			t.Fatal(err)
+		}
+		sets[i] = set
+	}
+
+	var allowed int64
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func(set *Set) {
+			defer wg.Done()
+			if ok, _ := set.Allow(Keys{AppKey: "shared"}); ok {
+				atomic.AddInt64(&allowed, 1)
+			}
+		}(sets[i%2])
+	}
+	wg.Wait()
+
+	if allowed != 50 {
+		t.Fatalf("allowed %d requests across two nodes, want 50", allowed)
+	}
+
+	//被拒绝的请求不占用计数
+	var total int64
+	f.mu.Lock()
+	for _, item := range f.items {
+		total += item.n
+	}
+	f.mu.Unlock()
+	if total != 50 {
+		t.Fatalf("stored count = %d, want 50", total)
+	}
+}
+
+//redis不可用时放行 并通知错误
+func TestRedisStoreUnavailable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+
+	var errs int64
+	sw := NewSlidingWindowStore(1, time.Minute, NewRedisStore(StoreConfig{Addr: addr}))
+	sw.OnError = func(error) { atomic.AddInt64(&errs, 1) }
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := sw.Allow("k"); !ok {
+			t.Fatal("requests should be allowed while redis is unavailable")
+		}
+	}
+	if errs != 3 {
+		t.Fatalf("OnError called %d times, want 3", errs)
+	}
+}
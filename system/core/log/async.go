@@ -0,0 +1,217 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/**
+异步写入日志文件
+日志先进入缓冲队列 由单独的goroutine批量写入 定时或缓冲满时刷新到文件
+队列满时按配置 block等待 或 drop丢弃并计数
+*/
+
+const (
+	PolicyBlock = "block" //队列满时等待
+	PolicyDrop  = "drop"  //队列满时丢弃
+)
+
+//写入文件的统一接口 同步写入时直接使用rotateFile
+type writer interface {
+	Write(p []byte) (int, error)
+	Flush()
+}
+
+type asyncWriter struct {
+	out     *rotateFile
+	ch      chan []byte
+	flushCh chan chan struct{}
+	drop    bool
+	dropped uint64 //未上报的丢弃条数
+	total   uint64 //累计丢弃条数
+	closed  int32
+	lock    sync.RWMutex //保护flushCh的发送与关闭
+	wg      sync.WaitGroup
+}
+
+func newAsyncWriter(out *rotateFile, conf Config) *asyncWriter {
+	size := conf.BufferSize
+	if size <= 0 {
+		size = 4096
+	}
+
+	interval := time.Duration(conf.FlushInterval) * time.Millisecond
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	w := &asyncWriter{
+		out:     out,
+		ch:      make(chan []byte, size),
+		flushCh: make(chan chan struct{}),
+		drop:    conf.Policy == PolicyDrop,
+	}
+
+	w.wg.Add(1)
+	go w.loop(interval)
+
+	return w
+}
+
+func (this *asyncWriter) Write(p []byte) (int, error) {
+	//已关闭时直接同步写入
+	if atomic.LoadInt32(&this.closed) == 1 {
+		return this.out.Write(p)
+	}
+
+	//io.Writer不能保留p 调用方可能复用p 如标准库log、bufio
+	p = append([]byte(nil), p...)
+
+	if this.drop {
+		select {
+		case this.ch <- p:
+		default:
+			atomic.AddUint64(&this.dropped, 1)
+			atomic.AddUint64(&this.total, 1)
+		}
+	} else {
+		this.ch <- p
+	}
+
+	return len(p), nil
+}
+
+//等待队列中已有的日志全部写入文件
+func (this *asyncWriter) Flush() {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+
+	if atomic.LoadInt32(&this.closed) == 1 {
+		return
+	}
+
+	done := make(chan struct{})
+	this.flushCh <- done
+	<-done
+}
+
+//写入剩余日志并停止后台goroutine 之后的日志改为同步写入
+func (this *asyncWriter) Close() {
+	this.lock.Lock()
+	if !atomic.CompareAndSwapInt32(&this.closed, 0, 1) {
+		this.lock.Unlock()
+		return
+	}
+	close(this.flushCh)
+	this.lock.Unlock()
+
+	this.wg.Wait()
+
+	//关闭期间进入队列的日志
+	for {
+		select {
+		case p := <-this.ch:
+			if _, err := this.out.Write(p); err != nil {
+				writeFailed(err, p)
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (this *asyncWriter) loop(interval time.Duration) {
+	defer this.wg.Done()
+
+	//不使用bufio.Writer 其写入出错后会一直返回同一个错误 该前缀的日志将无法再写入
+	b := &batch{out: this.out, buf: make([]byte, 0, batchSize)}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	//取出队列中当前全部日志
+	drain := func() {
+		for {
+			select {
+			case p := <-this.ch:
+				b.write(p)
+			default:
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case p := <-this.ch:
+			b.write(p)
+		case <-ticker.C:
+			this.reportDropped(b)
+			b.flush()
+		case done, ok := <-this.flushCh:
+			drain()
+			this.reportDropped(b)
+			b.flush()
+			if !ok {
+				return
+			}
+			close(done)
+		}
+	}
+}
+
+//批量写入的缓冲大小
+const batchSize = 64 * 1024
+
+//批量写入文件 写入失败时将本批日志输出到标准错误 下一批重新写入文件
+type batch struct {
+	out *rotateFile
+	buf []byte
+}
+
+func (this *batch) write(p []byte) {
+	if len(this.buf) > 0 && len(this.buf)+len(p) > batchSize {
+		this.flush()
+	}
+
+	this.buf = append(this.buf, p...)
+}
+
+func (this *batch) flush() {
+	if len(this.buf) == 0 {
+		return
+	}
+
+	if _, err := this.out.Write(this.buf); err != nil {
+		writeFailed(err, this.buf)
+	}
+
+	this.buf = this.buf[:0]
+}
+
+//写入日志失败时 输出到标准错误 避免日志丢失
+func writeFailed(err error, data []byte) {
+	_, _ = fmt.Fprint(os.Stderr, "写入日志失败:"+err.Error()+" "+string(data))
+}
+
+//累计丢弃的日志条数 用于监控
+func Dropped() uint64 {
+	var n uint64
+	for _, w := range allWriters() {
+		if a, ok := w.(*asyncWriter); ok {
+			n += atomic.LoadUint64(&a.total)
+		}
+	}
+
+	return n
+}
+
+//记录被丢弃的日志条数
+func (this *asyncWriter) reportDropped(b *batch) {
+	n := atomic.SwapUint64(&this.dropped, 0)
+	if n > 0 {
+		b.write(formatDropped(n))
+	}
+}
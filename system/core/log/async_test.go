@@ -0,0 +1,247 @@
+package log
+
+import (
+	"io"
+	"io/ioutil"
+	stdlog "log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func tempLogDir(tb testing.TB) string {
+	tb.Helper()
+
+	dir, err := ioutil.TempDir("", "gosab-log")
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	return dir
+}
+
+//写入失败后 后续的日志仍能正常写入 失败的日志输出到标准错误
+func TestAsyncWriterRecoversAfterWriteError(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	defer SetConfig(Config{})
+
+	//日志目录的上级是普通文件 创建目录失败
+	blocker := filepath.Join(dir, "blocker")
+	if err := ioutil.WriteFile(blocker, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	SetConfig(Config{Dir: filepath.Join(blocker, "logs")})
+
+	stderr, err := ioutil.TempFile(dir, "stderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := os.Stderr
+	os.Stderr = stderr
+	defer func() { os.Stderr = orig }()
+
+	out := &rotateFile{prefix: "recover_"}
+	w := newAsyncWriter(out, getConfig())
+	defer w.Close()
+
+	_, _ = w.Write([]byte("lost line\n"))
+	w.Flush()
+
+	SetConfig(Config{Dir: dir})
+	_, _ = w.Write([]byte("second line\n"))
+	w.Flush()
+
+	b, err := ioutil.ReadFile(out.name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "second line\n" {
+		t.Fatalf("log file = %q, want only the line written after the error", b)
+	}
+
+	b, _ = ioutil.ReadFile(stderr.Name())
+	if !strings.Contains(string(b), "lost line") {
+		t.Fatalf("stderr = %q, want the failed line", b)
+	}
+}
+
+func TestAsyncWriterDropPolicy(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	defer SetConfig(Config{})
+	SetConfig(Config{Dir: dir})
+
+	out := &rotateFile{prefix: "drop_"}
+	w := &asyncWriter{out: out, ch: make(chan []byte, 1), flushCh: make(chan chan struct{}), drop: true}
+
+	//后台goroutine未启动 队列满后丢弃
+	for i := 0; i < 3; i++ {
+		_, _ = w.Write([]byte("line\n"))
+	}
+	if n := w.total; n != 2 {
+		t.Fatalf("dropped = %d, want 2", n)
+	}
+
+	w.wg.Add(1)
+	go w.loop(time.Second)
+	w.Close()
+
+	b, err := ioutil.ReadFile(out.name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(b), "line\n") || !strings.Contains(string(b), "丢弃日志2条") {
+		t.Fatalf("log file = %q", b)
+	}
+}
+
+//调用方复用缓冲区时 已写入的日志不受影响
+func TestAsyncWriterCopiesBuffer(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	defer SetConfig(Config{})
+	SetConfig(Config{Dir: dir})
+
+	out := &rotateFile{prefix: "copy_"}
+	w := &asyncWriter{out: out, ch: make(chan []byte, 10), flushCh: make(chan chan struct{})}
+
+	//后台goroutine未启动 写入的内容在队列中等待
+	buf := []byte("first\n")
+	_, _ = w.Write(buf)
+	copy(buf, "again\n")
+	_, _ = w.Write(buf)
+
+	w.wg.Add(1)
+	go w.loop(time.Second)
+	w.Close()
+
+	b, err := ioutil.ReadFile(out.name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "first\nagain\n" {
+		t.Fatalf("log file = %q", b)
+	}
+}
+
+//标准库log复用内部缓冲区 通过NLog.Write输出的每一行保持原样
+func TestNLogWriteWithStdLogger(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	defer SetConfig(Config{})
+	SetConfig(Config{Dir: dir})
+
+	std := stdlog.New(NewLog("", "stdlog_"), "", 0)
+	want := make([]string, 0, 500)
+	for i := 0; i < 500; i++ {
+		line := "line " + strconv.Itoa(i)
+		std.Print(line)
+		want = append(want, line)
+	}
+	Flush()
+
+	filesLock.Lock()
+	name := files["stdlog_"].name
+	filesLock.Unlock()
+
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSuffix(string(b), "\n"); got != strings.Join(want, "\n") {
+		t.Fatalf("log file has corrupted lines:\n%s", got)
+	}
+}
+
+var benchLine = []byte("INFO bench.go main.handler 42 2020-01-02 15:04:05 用户登录成功 uid=10086 ip=127.0.0.1\n")
+
+//原有的写入方式 每条日志 Stat、OpenFile、Seek、WriteAt、Close 全局加锁
+var legacyLock sync.Mutex
+
+func legacyWrite(name string, p []byte) {
+	legacyLock.Lock()
+	defer legacyLock.Unlock()
+
+	if _, err := os.Stat(name); err != nil {
+		f, err := os.Create(name)
+		if err != nil {
+			panic(err)
+		}
+		_ = f.Close()
+	}
+
+	f, err := os.OpenFile(name, os.O_WRONLY, os.ModeAppend)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+
+	n, _ := f.Seek(0, io.SeekEnd)
+	_, _ = f.WriteAt(p, n)
+}
+
+func BenchmarkLegacyOpenSeekClose(b *testing.B) {
+	dir := tempLogDir(b)
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "legacy.log")
+
+	b.SetBytes(int64(len(benchLine)))
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			legacyWrite(name, benchLine)
+		}
+	})
+}
+
+//保持文件打开 同步写入
+func BenchmarkSyncFile(b *testing.B) {
+	dir := tempLogDir(b)
+	defer os.RemoveAll(dir)
+	defer SetConfig(Config{})
+	SetConfig(Config{Dir: dir})
+
+	out := &rotateFile{prefix: "sync_"}
+	defer out.Close()
+
+	b.SetBytes(int64(len(benchLine)))
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, _ = out.Write(benchLine)
+		}
+	})
+}
+
+func benchmarkAsync(b *testing.B, policy string) {
+	dir := tempLogDir(b)
+	defer os.RemoveAll(dir)
+	defer SetConfig(Config{})
+	SetConfig(Config{Dir: dir, Policy: policy})
+
+	out := &rotateFile{prefix: "async_"}
+	defer out.Close()
+	w := newAsyncWriter(out, getConfig())
+
+	b.SetBytes(int64(len(benchLine)))
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, _ = w.Write(benchLine)
+		}
+	})
+	w.Close() //计入写入剩余日志的时间
+}
+
+func BenchmarkAsyncBlock(b *testing.B) {
+	benchmarkAsync(b, PolicyBlock)
+}
+
+func BenchmarkAsyncDrop(b *testing.B) {
+	benchmarkAsync(b, PolicyDrop)
+}
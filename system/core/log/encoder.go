@@ -0,0 +1,119 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+日志格式
+text: 级别 文件 函数 行号 时间 内容 key=value...  与原有格式一致 字段追加在末尾
+json: 每行一个json对象 便于ELK等直接解析
+*/
+
+const (
+	FormatText = "text"
+	FormatJson = "json"
+)
+
+//日志附带的字段
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+//生成字段 log.Info("下单成功", log.F("uid", 1))
+func F(key string, val interface{}) Field {
+	return Field{Key: key, Value: val}
+}
+
+//一条日志
+type entry struct {
+	level  string
+	file   string
+	fn     string
+	line   int
+	time   time.Time
+	msg    string
+	fields []Field
+}
+
+//按格式编码一条日志 以换行结尾
+func encode(format string, e *entry) []byte {
+	if format == FormatJson {
+		return encodeJson(e)
+	}
+
+	return encodeText(e)
+}
+
+func encodeText(e *entry) []byte {
+	return []byte(e.level + " " + e.file + " " + e.fn + " " + strconv.Itoa(e.line) + " " + e.time.Format("2006-01-02 15:04:05") + " " + e.msg + textFields(e.fields) + "\n")
+}
+
+//text格式的字段 以空格开头
+func textFields(fields []Field) string {
+	if len(fields) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	for _, f := range fields {
+		v := fmt.Sprint(f.Value)
+		if v == "" || strings.ContainsAny(v, " =\"\n") {
+			v = strconv.Quote(v)
+		}
+		b.WriteString(" " + f.Key + "=" + v)
+	}
+
+	return b.String()
+}
+
+func encodeJson(e *entry) []byte {
+	var b bytes.Buffer
+	b.WriteString(`{"level":`)
+	writeJsonValue(&b, e.level)
+	b.WriteString(`,"time":`)
+	writeJsonValue(&b, e.time.Format("2006-01-02T15:04:05.000Z07:00"))
+	b.WriteString(`,"file":`)
+	writeJsonValue(&b, e.file)
+	b.WriteString(`,"func":`)
+	writeJsonValue(&b, e.fn)
+	b.WriteString(`,"line":`)
+	b.WriteString(strconv.Itoa(e.line))
+	b.WriteString(`,"msg":`)
+	writeJsonValue(&b, e.msg)
+
+	for _, f := range e.fields {
+		key := f.Key
+		switch key {
+		case "level", "time", "file", "func", "line", "msg":
+			key = "field_" + key //避免覆盖基础字段
+		}
+
+		b.WriteByte(',')
+		writeJsonValue(&b, key)
+		b.WriteByte(':')
+		writeJsonValue(&b, f.Value)
+	}
+	b.WriteString("}\n")
+
+	return b.Bytes()
+}
+
+//无法编码为json的值 按字符串处理
+func writeJsonValue(b *bytes.Buffer, v interface{}) {
+	if err, ok := v.(error); ok {
+		v = err.Error()
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(v))
+	}
+	b.Write(data)
+}
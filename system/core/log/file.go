@@ -0,0 +1,364 @@
+package log
+
+import (
+	"compress/gzip"
+	"errors"
+	"github.com/solaa51/gosab/system/core/commonFunc"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+日志文件 按时间及大小切割
+文件名: 前缀+日期.log 如 2020-01-02.log 按小时切割时为 2020-01-02-15.log
+超过大小时 当前文件重命名为 2020-01-02.log.150405 (可选gzip压缩为.gz) 再创建新文件
+*/
+
+//日志文件配置 app.toml中的[log]
+type Config struct {
+	Format     string            `toml:"format"`     //日志格式 text(默认) json
+	Level      string            `toml:"level"`      //最低写入级别 TRACE(默认) DEBUG INFO WARN ERROR
+	Levels     map[string]string `toml:"levels"`     //按日志文件前缀单独设置的最低级别
+	Dir        string            `toml:"dir"`        //日志目录 默认为程序目录下的logs/
+	Rotate     string            `toml:"rotate"`     //按时间切割 day(默认) hour
+	MaxSize    int64             `toml:"maxSize"`    //单个文件最大值 MB 超过后切割 0不限制
+	Compress   bool              `toml:"compress"`   //切割后的文件是否gzip压缩
+	MaxBackups int               `toml:"maxBackups"` //最多保留的历史文件数 0不限制
+	MaxAge     int               `toml:"maxAge"`     //历史文件最多保留天数 0不限制
+
+	Sync          bool   `toml:"sync"`          //同步写入 默认异步写入 修改后需重启生效
+	BufferSize    int    `toml:"bufferSize"`    //异步写入的队列长度 默认4096条
+	FlushInterval int    `toml:"flushInterval"` //异步写入的刷新间隔 毫秒 默认1000
+	Policy        string `toml:"policy"`        //异步队列满时的处理 block(默认)等待 drop丢弃
+
+	Sinks []SinkConfig `toml:"sinks"` //日志输出端 未配置时写入日志文件
+}
+
+var (
+	confLock sync.RWMutex
+	config   Config
+
+	filesLock sync.Mutex
+	files     = make(map[string]*rotateFile) //按前缀共用日志文件
+	writers   = make(map[string]writer)      //按前缀共用的写入方式 同步或异步
+)
+
+//设置日志配置 对已打开的日志文件同样生效
+func SetConfig(c Config) {
+	confLock.Lock()
+	config = c
+	confLock.Unlock()
+
+	setLevels(c)
+	setSinks(c.Sinks)
+}
+
+func getConfig() Config {
+	confLock.RLock()
+	defer confLock.RUnlock()
+
+	return config
+}
+
+//重新打开全部日志文件 用于配合logrotate等外部工具
+func Reopen() {
+	filesLock.Lock()
+	defer filesLock.Unlock()
+
+	for _, f := range files {
+		_ = f.reopen()
+	}
+}
+
+//等待全部异步日志写入文件 服务关闭前调用
+func Flush() {
+	for _, w := range allWriters() {
+		w.Flush()
+	}
+}
+
+//写入全部异步日志 并停止异步写入 之后的日志改为同步写入
+//同时关闭全部输出端
+func Close() {
+	for _, w := range allWriters() {
+		if a, ok := w.(*asyncWriter); ok {
+			a.Close()
+		}
+	}
+
+	closeSinks()
+}
+
+func allWriters() []writer {
+	filesLock.Lock()
+	defer filesLock.Unlock()
+
+	list := make([]writer, 0, len(writers))
+	for _, w := range writers {
+		list = append(list, w)
+	}
+
+	return list
+}
+
+//获取前缀对应的日志写入方式
+func getWriter(prefix string) writer {
+	filesLock.Lock()
+	defer filesLock.Unlock()
+
+	w, ok := writers[prefix]
+	if !ok {
+		f := &rotateFile{prefix: prefix}
+		files[prefix] = f
+
+		conf := getConfig()
+		if conf.Sync {
+			w = f
+		} else {
+			w = newAsyncWriter(f, conf)
+		}
+		writers[prefix] = w
+
+		listenReopen()
+	}
+
+	return w
+}
+
+type rotateFile struct {
+	sync.Mutex
+	prefix string
+	file   *os.File
+	name   string //当前文件完整路径
+	period string //当前文件对应的时间段
+	size   int64
+
+	millLock sync.Mutex //压缩及清理历史文件
+}
+
+func (this *rotateFile) Write(p []byte) (int, error) {
+	this.Lock()
+	defer this.Unlock()
+
+	conf := getConfig()
+	period := this.currentPeriod(conf)
+
+	if this.file == nil || period != this.period {
+		if err := this.open(conf, period); err != nil {
+			return 0, err
+		}
+	} else if conf.MaxSize > 0 && this.size+int64(len(p)) > conf.MaxSize*1024*1024 && this.size > 0 {
+		if err := this.rotate(conf); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := this.file.Write(p)
+	this.size += int64(n)
+
+	return n, err
+}
+
+//同步写入 无需刷新
+func (this *rotateFile) Flush() {}
+
+//按原文件名重新打开 文件被外部移走时会创建新文件
+func (this *rotateFile) reopen() error {
+	this.Lock()
+	defer this.Unlock()
+
+	if this.file == nil {
+		return nil
+	}
+
+	_ = this.file.Close()
+	this.file = nil
+
+	return this.open(getConfig(), this.period)
+}
+
+func (this *rotateFile) Close() error {
+	this.Lock()
+	defer this.Unlock()
+
+	if this.file == nil {
+		return nil
+	}
+
+	err := this.file.Close()
+	this.file = nil
+
+	return err
+}
+
+//打开时间段对应的日志文件 时间段变化时 原文件作为历史文件处理
+func (this *rotateFile) open(conf Config, period string) error {
+	old := ""
+	if this.file != nil {
+		_ = this.file.Close()
+		this.file = nil
+		if period != this.period {
+			old = this.name
+		}
+	}
+
+	dir := logDir(conf)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	name := dir + this.prefix + period + ".log"
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	this.file = f
+	this.name = name
+	this.period = period
+	this.size = info.Size()
+
+	if old != "" {
+		go this.mill(conf, old)
+	}
+
+	return nil
+}
+
+//超过大小 切割当前文件
+func (this *rotateFile) rotate(conf Config) error {
+	_ = this.file.Close()
+	this.file = nil
+
+	backup := this.name + "." + time.Now().Format("150405.000")
+	if err := os.Rename(this.name, backup); err != nil {
+		return err
+	}
+
+	if err := this.open(conf, this.period); err != nil {
+		return err
+	}
+
+	go this.mill(conf, backup)
+
+	return nil
+}
+
+//压缩历史文件 并按数量和天数清理
+func (this *rotateFile) mill(conf Config, backup string) {
+	this.millLock.Lock()
+	defer this.millLock.Unlock()
+
+	if conf.Compress && backup != "" {
+		_ = compressFile(backup)
+	}
+
+	if conf.MaxBackups <= 0 && conf.MaxAge <= 0 {
+		return
+	}
+
+	dir := logDir(conf)
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	pattern := regexp.MustCompile(`^` + regexp.QuoteMeta(this.prefix) + `\d{4}-\d{2}-\d{2}(-\d{2})?\.log(\.[\d.]+)?(\.gz)?$`)
+
+	this.Lock()
+	current := filepath.Base(this.name)
+	this.Unlock()
+
+	backups := make([]os.FileInfo, 0)
+	for _, v := range infos {
+		if v.IsDir() || v.Name() == current || !pattern.MatchString(v.Name()) {
+			continue
+		}
+		backups = append(backups, v)
+	}
+
+	//新的在前
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].ModTime().After(backups[j].ModTime())
+	})
+
+	deadline := time.Now().AddDate(0, 0, -conf.MaxAge)
+	for k, v := range backups {
+		if (conf.MaxBackups > 0 && k >= conf.MaxBackups) || (conf.MaxAge > 0 && v.ModTime().Before(deadline)) {
+			_ = os.Remove(dir + v.Name())
+		}
+	}
+}
+
+//当前时间对应的时间段
+func (this *rotateFile) currentPeriod(conf Config) string {
+	if conf.Rotate == "hour" {
+		return time.Now().Format("2006-01-02-15")
+	}
+
+	return commonFunc.Date("Y-m-d", 0)
+}
+
+//日志目录 以/结尾
+func logDir(conf Config) string {
+	if conf.Dir == "" {
+		return commonFunc.GetAppDir() + "logs/"
+	}
+
+	if !strings.HasSuffix(conf.Dir, "/") {
+		return conf.Dir + "/"
+	}
+
+	return conf.Dir
+}
+
+//gzip压缩文件 成功后删除原文件
+func compressFile(name string) error {
+	if strings.HasSuffix(name, ".gz") {
+		return errors.New("文件已压缩")
+	}
+
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(name+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	if _, err = io.Copy(gz, src); err != nil {
+		_ = gz.Close()
+		_ = dst.Close()
+		_ = os.Remove(name + ".gz")
+		return err
+	}
+
+	if err = gz.Close(); err != nil {
+		_ = dst.Close()
+		_ = os.Remove(name + ".gz")
+		return err
+	}
+
+	if err = dst.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(name)
+}
@@ -0,0 +1,83 @@
+package log
+
+import (
+	"strings"
+	"sync/atomic"
+)
+
+/**
+日志级别过滤
+级别从低到高: TRACE DEBUG INFO WARN ERROR 低于最低级别的日志不会写入
+app.toml配置 修改后通过配置文件热更新生效 无需重启:
+	[log]
+	level = "WARN"         # 默认的最低级别 不配置时全部写入
+	[log.levels]
+	order_ = "DEBUG"       # 按日志文件前缀单独设置
+只对Info、Warn等带级别的日志生效 通过Write原样写入的日志(如访问日志)不过滤
+*/
+
+const (
+	LevelTrace = iota
+	LevelDebug
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[string]int{
+	"TRACE": LevelTrace,
+	"DEBUG": LevelDebug,
+	"INFO":  LevelInfo,
+	"WARN":  LevelWarn,
+	"ERROR": LevelError,
+}
+
+//当前生效的级别配置
+type levelConf struct {
+	def      int
+	prefixes map[string]int
+}
+
+var levels atomic.Value
+
+func init() {
+	levels.Store(&levelConf{def: LevelTrace, prefixes: map[string]int{}})
+}
+
+//按配置更新级别
+func setLevels(c Config) {
+	lc := &levelConf{
+		def:      ParseLevel(c.Level),
+		prefixes: make(map[string]int, len(c.Levels)),
+	}
+
+	for k, v := range c.Levels {
+		lc.prefixes[k] = ParseLevel(v)
+	}
+
+	levels.Store(lc)
+}
+
+//级别名称转换为级别 无法识别时为TRACE 即全部写入
+func ParseLevel(name string) int {
+	if l, ok := levelNames[strings.ToUpper(strings.TrimSpace(name))]; ok {
+		return l
+	}
+
+	return LevelTrace
+}
+
+//前缀对应的最低级别
+func minLevel(prefix string) int {
+	lc := levels.Load().(*levelConf)
+	if l, ok := lc.prefixes[prefix]; ok {
+		return l
+	}
+
+	return lc.def
+}
+
+//该级别的日志是否会写入 用于避免生成不会写入的日志内容
+func (l *NLog) Enabled(level string) bool {
+	return levelNames[level] >= minLevel(l.prefix)
+}
@@ -2,14 +2,11 @@ package log
 
 import (
 	"fmt"
-	"github.com/solaa51/gosab/system/core/commonFunc"
-	"io"
-	"os"
 	"path/filepath"
 	"runtime"
 	"strconv"
-	"strings"
 	"sync"
+	"time"
 )
 
 //第三版日志处理
@@ -17,6 +14,7 @@ type NLog struct {
 	sync.Mutex
 	prefix string
 	env    string
+	fields []Field //子日志附带的字段
 }
 
 //文件名前缀
@@ -28,29 +26,49 @@ func NewLog(env, prefix string) *NLog {
 	return l
 }
 
-func (l *NLog) Info(s string) {
-	l.echo("INFO", s)
+//生成附带字段的子日志 与原日志写入同一文件
+func (l *NLog) With(key string, val interface{}) *NLog {
+	fields := make([]Field, 0, len(l.fields)+1)
+	fields = append(fields, l.fields...)
+	fields = append(fields, Field{Key: key, Value: val})
+
+	return &NLog{
+		prefix: l.prefix,
+		env:    l.env,
+		fields: fields,
+	}
 }
 
-func (l *NLog) Warn(s string) {
-	l.echo("WARN", s)
+//原样写入日志文件 不附加级别等信息 用于访问日志等自定义格式
+//p需以换行结尾
+func (l *NLog) Write(p []byte) (int, error) {
+	return getWriter(l.prefix).Write(p)
 }
 
-func (l *NLog) Error(s string) {
-	l.echo("ERROR", s)
+func (l *NLog) Info(s string, fields ...Field) {
+	l.echo("INFO", s, fields)
 }
 
-func (l *NLog) Trace(s string) {
-	l.echo("TRACE", s)
+func (l *NLog) Warn(s string, fields ...Field) {
+	l.echo("WARN", s, fields)
 }
 
-func (l *NLog) Debug(s string) {
-	l.echo("DEBUG", s)
+func (l *NLog) Error(s string, fields ...Field) {
+	l.echo("ERROR", s, fields)
 }
 
-func (l *NLog) echo(flag, s string) {
-	l.Lock()
-	defer l.Unlock()
+func (l *NLog) Trace(s string, fields ...Field) {
+	l.echo("TRACE", s, fields)
+}
+
+func (l *NLog) Debug(s string, fields ...Field) {
+	l.echo("DEBUG", s, fields)
+}
+
+func (l *NLog) echo(flag, s string, fields []Field) {
+	if !l.Enabled(flag) {
+		return
+	}
 
 	//| log.Lshortfile 输出的是 当前出错输出内容的行 没什么意义
 	var pc uintptr
@@ -60,40 +78,55 @@ func (l *NLog) echo(flag, s string) {
 
 	pc, fileName, line, _ = runtime.Caller(2)
 	funcName = runtime.FuncForPC(pc).Name()
-	if strings.HasSuffix(funcName, "myContext.NewContext") {
-		pc, fileName, line, _ = runtime.Caller(3)
-		funcName = runtime.FuncForPC(pc).Name()
-	}
 
 	fileName = filepath.Base(fileName)
 
-	msg := flag + " " + fileName + " " + funcName + " " + strconv.Itoa(line) + " " + commonFunc.Date("Y-m-d H:i:s", 0) + " " + s + "\n"
+	e := &entry{
+		level:  flag,
+		file:   fileName,
+		fn:     funcName,
+		line:   line,
+		time:   time.Now(),
+		msg:    s,
+		fields: l.fields,
+	}
+	if len(fields) > 0 {
+		e.fields = append(append(make([]Field, 0, len(l.fields)+len(fields)), l.fields...), fields...)
+	}
 
-	//获取文件
-	logDateName := l.prefix + commonFunc.Date("Y-m-d", 0)
-	logFileName := commonFunc.GetAppDir() + "logs/" + logDateName + ".log"
+	//按输出端的格式编码 同一格式只编码一次
+	level := levelNames[flag]
+	encoded := make(map[string][]byte, 2)
+	sinks, configured := getSinks()
+	for _, v := range sinks {
+		if level < v.level {
+			continue
+		}
 
-	if _, err := os.Stat(logFileName); err != nil {
-		// 文件不存在,创建
-		_, err := os.Create(logFileName)
-		if err != nil {
-			panic(err)
+		data, ok := encoded[v.format]
+		if !ok {
+			data = encode(v.format, e)
+			encoded[v.format] = data
 		}
-	}
 
-	logFile, err := os.OpenFile(logFileName, os.O_WRONLY, os.ModeAppend)
-	if err != nil {
-		panic("打开日志文件时发生错误")
+		if err := v.sink.Write(&Record{Level: level, Prefix: l.prefix, Data: data}); err != nil {
+			writeFailed(err, data)
+		}
 	}
 
-	//延迟关闭文件
-	defer logFile.Close()
-
-	//写入文件
-	n, _ := logFile.Seek(0, io.SeekEnd)
-	_, _ = logFile.WriteAt([]byte(msg), n)
-
-	if l.env == "local" || l.env == "test" {
-		fmt.Println(s)
+	//未配置输出端时 本地及测试环境同时打印到标准输出
+	if !configured && (l.env == "local" || l.env == "test") {
+		fmt.Println(s + textFields(e.fields))
 	}
 }
+
+//异步队列满时丢弃日志的提示
+func formatDropped(n uint64) []byte {
+	return encode(getConfig().Format, &entry{
+		level: "WARN",
+		file:  "async.go",
+		fn:    "log.(*asyncWriter).reportDropped",
+		time:  time.Now(),
+		msg:   "日志队列已满 丢弃日志" + strconv.FormatUint(n, 10) + "条",
+	})
+}
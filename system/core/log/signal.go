@@ -0,0 +1,27 @@
+//go:build !windows
+// +build !windows
+
+package log
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+var reopenOnce sync.Once
+
+//收到SIGUSR1信号时 重新打开全部日志文件
+//配合logrotate的create方式使用: postrotate kill -USR1 pid
+func listenReopen() {
+	reopenOnce.Do(func() {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, syscall.SIGUSR1)
+		go func() {
+			for range ch {
+				Reopen()
+			}
+		}()
+	})
+}
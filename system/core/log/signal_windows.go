@@ -0,0 +1,4 @@
+package log
+
+//windows下没有SIGUSR1信号 需要时直接调用Reopen
+func listenReopen() {}
@@ -0,0 +1,181 @@
+package log
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+/**
+日志输出端 一条日志可同时输出到多个输出端 每个输出端有独立的最低级别和格式
+未配置输出端时 与原有行为一致: 写入日志文件 本地及测试环境同时打印到标准输出
+
+app.toml配置:
+	[[log.sinks]]
+	type = "file"                  # file 日志文件 | stdout | stderr | syslog | tcp | udp
+	level = "INFO"
+	format = "text"
+	[[log.sinks]]
+	type = "tcp"
+	addr = "127.0.0.1:5170"        # tcp udp 为收集端地址 syslog 为unix socket路径 默认/dev/log
+	format = "json"
+	level = "WARN"
+
+自定义输出端:
+	log.AddSink(mySink, "ERROR", "json")
+*/
+
+//交给输出端的一条日志
+type Record struct {
+	Level  int    //日志级别
+	Prefix string //日志文件前缀 即日志名称
+	Data   []byte //按输出端格式编码后的内容 以换行结尾
+}
+
+//日志输出端
+type Sink interface {
+	Write(r *Record) error
+	Close() error
+}
+
+//单个输出端配置
+type SinkConfig struct {
+	Type       string `toml:"type"`       //file stdout stderr syslog tcp udp
+	Level      string `toml:"level"`      //最低级别 默认TRACE
+	Format     string `toml:"format"`     //text(默认) json
+	Addr       string `toml:"addr"`       //tcp udp 收集端地址 syslog unix socket路径
+	Tag        string `toml:"tag"`        //syslog 标识 默认为程序名
+	BufferSize int    `toml:"bufferSize"` //tcp udp 发送队列长度 默认4096条 队列满时丢弃
+}
+
+//带级别和格式的输出端
+type sinkEntry struct {
+	sink   Sink
+	level  int
+	format string
+}
+
+var (
+	sinkLock    sync.RWMutex
+	sinkConfs   []SinkConfig
+	confSinks   []sinkEntry //按配置生成的输出端
+	customSinks []sinkEntry //代码中添加的输出端
+)
+
+//添加自定义输出端 配置热更新时不会被移除
+func AddSink(s Sink, level string, format string) {
+	sinkLock.Lock()
+	defer sinkLock.Unlock()
+
+	customSinks = append(customSinks, sinkEntry{sink: s, level: ParseLevel(level), format: format})
+}
+
+//按配置重建输出端 配置未变化时保留原有输出端
+func setSinks(confs []SinkConfig) {
+	sinkLock.Lock()
+	defer sinkLock.Unlock()
+
+	if reflect.DeepEqual(confs, sinkConfs) {
+		return
+	}
+
+	list := make([]sinkEntry, 0, len(confs))
+	for _, c := range confs {
+		s, err := newSink(c)
+		if err != nil {
+			_, _ = os.Stderr.WriteString("日志输出端配置错误:" + err.Error() + "\n")
+			continue
+		}
+		list = append(list, sinkEntry{sink: s, level: ParseLevel(c.Level), format: c.Format})
+	}
+
+	for _, v := range confSinks {
+		_ = v.sink.Close()
+	}
+
+	sinkConfs = confs
+	confSinks = list
+}
+
+//当前全部输出端 未配置输出端时返回nil 表示使用默认行为
+func getSinks() ([]sinkEntry, bool) {
+	sinkLock.RLock()
+	defer sinkLock.RUnlock()
+
+	list := make([]sinkEntry, 0, len(confSinks)+len(customSinks)+1)
+	configured := len(sinkConfs) > 0
+	if configured {
+		list = append(list, confSinks...)
+	} else {
+		list = append(list, sinkEntry{sink: fileSink{}, level: LevelTrace, format: getConfig().Format})
+	}
+	list = append(list, customSinks...)
+
+	return list, configured
+}
+
+//关闭全部输出端
+func closeSinks() {
+	sinkLock.Lock()
+	defer sinkLock.Unlock()
+
+	for _, v := range confSinks {
+		_ = v.sink.Close()
+	}
+	for _, v := range customSinks {
+		_ = v.sink.Close()
+	}
+}
+
+func newSink(c SinkConfig) (Sink, error) {
+	switch strings.ToLower(c.Type) {
+	case "file", "":
+		return fileSink{}, nil
+	case "stdout":
+		return &streamSink{out: os.Stdout}, nil
+	case "stderr":
+		return &streamSink{out: os.Stderr}, nil
+	case "syslog":
+		return newSyslogSink(c.Addr, c.Tag), nil
+	case "tcp", "udp":
+		if c.Addr == "" {
+			return nil, errors.New(c.Type + "输出端未配置addr")
+		}
+		return newNetSink(strings.ToLower(c.Type), c.Addr, c.BufferSize), nil
+	default:
+		return nil, errors.New("不支持的输出端类型:" + c.Type)
+	}
+}
+
+//写入按前缀区分的日志文件 即原有的文件日志
+type fileSink struct{}
+
+func (fileSink) Write(r *Record) error {
+	_, err := getWriter(r.Prefix).Write(r.Data)
+	return err
+}
+
+//日志文件由Close统一处理
+func (fileSink) Close() error {
+	return nil
+}
+
+//标准输出 标准错误
+type streamSink struct {
+	sync.Mutex
+	out *os.File
+}
+
+func (this *streamSink) Write(r *Record) error {
+	this.Lock()
+	defer this.Unlock()
+
+	_, err := this.out.Write(r.Data)
+	return err
+}
+
+func (this *streamSink) Close() error {
+	return nil
+}
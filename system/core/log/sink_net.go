@@ -0,0 +1,151 @@
+package log
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//tcp udp 发送到日志收集端 每条日志一行
+//通过队列异步发送 断开后按指数退避重连 队列满时丢弃 不阻塞业务
+type netSink struct {
+	network string
+	addr    string
+	ch      chan []byte
+	done    chan struct{}
+	closed  int32
+	dropped uint64
+	wg      sync.WaitGroup
+}
+
+const (
+	netMinBackoff = 100 * time.Millisecond
+	netMaxBackoff = 30 * time.Second
+)
+
+func newNetSink(network, addr string, size int) *netSink {
+	if size <= 0 {
+		size = 4096
+	}
+
+	s := &netSink{
+		network: network,
+		addr:    addr,
+		ch:      make(chan []byte, size),
+		done:    make(chan struct{}),
+	}
+
+	s.wg.Add(1)
+	go s.loop()
+
+	return s
+}
+
+func (this *netSink) Write(r *Record) error {
+	if atomic.LoadInt32(&this.closed) == 1 {
+		return nil
+	}
+
+	select {
+	case this.ch <- r.Data:
+	default:
+		atomic.AddUint64(&this.dropped, 1)
+	}
+
+	return nil
+}
+
+//最多等待2秒发送剩余日志
+func (this *netSink) Close() error {
+	if !atomic.CompareAndSwapInt32(&this.closed, 0, 1) {
+		return nil
+	}
+
+	close(this.done)
+
+	wait := make(chan struct{})
+	go func() {
+		this.wg.Wait()
+		close(wait)
+	}()
+
+	select {
+	case <-wait:
+	case <-time.After(2 * time.Second):
+	}
+
+	return nil
+}
+
+//累计丢弃的条数
+func (this *netSink) Dropped() uint64 {
+	return atomic.LoadUint64(&this.dropped)
+}
+
+func (this *netSink) loop() {
+	defer this.wg.Done()
+
+	var conn net.Conn
+	var pending []byte
+	backoff := netMinBackoff
+
+	defer func() {
+		if conn != nil {
+			_ = conn.Close()
+		}
+	}()
+
+	for {
+		if pending == nil {
+			select {
+			case pending = <-this.ch:
+			case <-this.done:
+				//关闭时 只在已连接的情况下发送剩余日志
+				for conn != nil {
+					select {
+					case p := <-this.ch:
+						if this.send(conn, p) != nil {
+							return
+						}
+					default:
+						return
+					}
+				}
+				return
+			}
+		}
+
+		if conn == nil {
+			c, err := net.DialTimeout(this.network, this.addr, 3*time.Second)
+			if err != nil {
+				select {
+				case <-time.After(backoff):
+				case <-this.done:
+					return
+				}
+				backoff *= 2
+				if backoff > netMaxBackoff {
+					backoff = netMaxBackoff
+				}
+				continue
+			}
+			conn = c
+			backoff = netMinBackoff
+		}
+
+		if err := this.send(conn, pending); err != nil {
+			//连接已断开 重连后重新发送这一条
+			_ = conn.Close()
+			conn = nil
+			continue
+		}
+		pending = nil
+	}
+}
+
+func (this *netSink) send(conn net.Conn, p []byte) error {
+	_ = conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	_, err := conn.Write(p)
+	return err
+}
@@ -0,0 +1,329 @@
+package log
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+//本地的tcp日志收集端 按行读取 新建立的连接放入conns
+type fakeCollector struct {
+	ln    net.Listener
+	lines chan string
+	conns chan net.Conn
+}
+
+func newFakeCollector(t *testing.T, addr string) *fakeCollector {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &fakeCollector{ln: ln, lines: make(chan string, 100), conns: make(chan net.Conn, 10)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			c.conns <- conn
+
+			go func() {
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					c.lines <- line
+				}
+			}()
+		}
+	}()
+
+	return c
+}
+
+func (this *fakeCollector) expect(t *testing.T, want string) {
+	t.Helper()
+
+	select {
+	case line := <-this.lines:
+		if line != want {
+			t.Fatalf("collector got %q, want %q", line, want)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("collector did not receive %q", want)
+	}
+}
+
+func record(s string) *Record {
+	return &Record{Level: LevelInfo, Data: []byte(s)}
+}
+
+func TestNetSinkTCP(t *testing.T) {
+	c := newFakeCollector(t, "127.0.0.1:0")
+	defer c.ln.Close()
+
+	s := newNetSink("tcp", c.ln.Addr().String(), 0)
+
+	for i := 0; i < 3; i++ {
+		_ = s.Write(record("line " + strconv.Itoa(i) + "\n"))
+	}
+	for i := 0; i < 3; i++ {
+		c.expect(t, "line "+strconv.Itoa(i)+"\n")
+	}
+
+	//关闭时发送队列中剩余的日志
+	_ = s.Write(record("last\n"))
+	_ = s.Close()
+	c.expect(t, "last\n")
+
+	if err := s.Write(record("after close\n")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//收集端断开连接后 自动重连继续发送
+func TestNetSinkTCPReconnect(t *testing.T) {
+	c := newFakeCollector(t, "127.0.0.1:0")
+	defer c.ln.Close()
+
+	s := newNetSink("tcp", c.ln.Addr().String(), 0)
+	defer s.Close()
+
+	_ = s.Write(record("first\n"))
+	c.expect(t, "first\n")
+
+	first := <-c.conns
+	_ = first.Close()
+
+	//对端关闭后的第一次写入可能仍然成功 持续写入直到在新连接上收到
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		_ = s.Write(record("again\n"))
+
+		select {
+		case <-c.conns:
+			c.expect(t, "again\n")
+			return
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	t.Fatal("sink did not reconnect")
+}
+
+//收集端未启动时按退避间隔重试 启动后发送未送达的日志
+func TestNetSinkTCPBackoff(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+
+	s := newNetSink("tcp", addr, 0)
+	defer s.Close()
+
+	_ = s.Write(record("pending\n"))
+
+	//100ms 200ms 400ms... 收集端稍后才启动
+	time.Sleep(3 * netMinBackoff)
+	c := newFakeCollector(t, addr)
+	defer c.ln.Close()
+
+	c.expect(t, "pending\n")
+}
+
+func TestNetSinkUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	s := newNetSink("udp", pc.LocalAddr().String(), 0)
+	defer s.Close()
+
+	_ = s.Write(record("udp line\n"))
+
+	_ = pc.SetReadDeadline(time.Now().Add(3 * time.Second))
+	buf := make([]byte, 1024)
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "udp line\n" {
+		t.Fatalf("udp datagram = %q", buf[:n])
+	}
+}
+
+//队列满时丢弃 不阻塞写入
+func TestNetSinkDropWhenFull(t *testing.T) {
+	s := &netSink{network: "tcp", addr: "127.0.0.1:1", ch: make(chan []byte, 2), done: make(chan struct{})}
+
+	for i := 0; i < 5; i++ {
+		if err := s.Write(record("x\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := s.Dropped(); n != 3 {
+		t.Fatalf("Dropped() = %d, want 3", n)
+	}
+}
+
+//收集端一直不可用时 关闭不会长时间阻塞
+func TestNetSinkCloseWithoutCollector(t *testing.T) {
+	s := newNetSink("tcp", "127.0.0.1:1", 0)
+	_ = s.Write(record("never sent\n"))
+
+	start := time.Now()
+	_ = s.Close()
+	if d := time.Since(start); d > 2500*time.Millisecond {
+		t.Fatalf("Close took %s", d)
+	}
+}
+
+var syslogLine = regexp.MustCompile(`^<(\d+)>[A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2} gosab-test\[(\d+)\]: (.*)\n$`)
+
+func checkSyslog(t *testing.T, msg string, pri int, text string) {
+	t.Helper()
+
+	m := syslogLine.FindStringSubmatch(msg)
+	if m == nil {
+		t.Fatalf("syslog message %q does not match RFC3164 framing", msg)
+	}
+	if m[1] != strconv.Itoa(pri) || m[2] != strconv.Itoa(os.Getpid()) || m[3] != text {
+		t.Fatalf("syslog message %q, want pri %d text %q", msg, pri, text)
+	}
+}
+
+func TestSyslogSinkFraming(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "log.sock")
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	s := newSyslogSink(path, "gosab-test")
+	defer s.Close()
+
+	read := func() string {
+		_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+		buf := make([]byte, 2048)
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(buf[:n])
+	}
+
+	cases := []struct {
+		level int
+		pri   int
+	}{
+		{LevelError, 16*8 + 3},
+		{LevelWarn, 16*8 + 4},
+		{LevelInfo, 16*8 + 6},
+		{LevelDebug, 16*8 + 7},
+	}
+	for _, c := range cases {
+		if err = s.Write(&Record{Level: c.level, Data: []byte("hello world\n")}); err != nil {
+			t.Fatal(err)
+		}
+		checkSyslog(t, read(), c.pri, "hello world")
+	}
+
+	//只去掉末尾的换行 再以一个换行结尾
+	_ = s.Write(&Record{Level: LevelInfo, Data: []byte("a\nb\n\n")})
+	if msg := read(); !strings.HasSuffix(msg, "]: a\nb\n") {
+		t.Fatalf("syslog message %q, want trailing newlines collapsed", msg)
+	}
+}
+
+//syslog重启后 重新连接
+func TestSyslogSinkReconnect(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "log.sock")
+
+	listen := func() *net.UnixConn {
+		conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+
+	conn := listen()
+	s := newSyslogSink(path, "gosab-test")
+	defer s.Close()
+
+	if err := s.Write(record("one\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = conn.Close()
+	_ = os.Remove(path)
+	conn = listen()
+	defer conn.Close()
+
+	if err := s.Write(record("two\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	buf := make([]byte, 2048)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSyslog(t, string(buf[:n]), 16*8+6, "two")
+}
+
+//流式unix socket 同样可用
+func TestSyslogSinkStream(t *testing.T) {
+	dir := tempLogDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "log.sock")
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	s := newSyslogSink(path, "gosab-test")
+	defer s.Close()
+
+	if err = s.Write(record("stream\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSyslog(t, line, 16*8+6, "stream")
+}
@@ -0,0 +1,102 @@
+package log
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//通过unix socket写入本机syslog RFC3164格式 facility为local0
+type syslogSink struct {
+	sync.Mutex
+	addr string
+	tag  string
+	conn net.Conn
+}
+
+//日志级别对应的syslog严重程度
+var syslogSeverity = map[int]int{
+	LevelTrace: 7,
+	LevelDebug: 7,
+	LevelInfo:  6,
+	LevelWarn:  4,
+	LevelError: 3,
+}
+
+const syslogFacility = 16 //local0
+
+func newSyslogSink(addr, tag string) *syslogSink {
+	if tag == "" {
+		tag = filepath.Base(os.Args[0])
+	}
+
+	return &syslogSink{addr: addr, tag: tag}
+}
+
+func (this *syslogSink) Write(r *Record) error {
+	this.Lock()
+	defer this.Unlock()
+
+	pri := syslogFacility*8 + syslogSeverity[r.Level]
+	msg := "<" + strconv.Itoa(pri) + ">" + time.Now().Format(time.Stamp) + " " + this.tag + "[" + strconv.Itoa(os.Getpid()) + "]: " + string(bytes.TrimRight(r.Data, "\n")) + "\n"
+
+	//连接断开时重连一次
+	for i := 0; i < 2; i++ {
+		if this.conn == nil {
+			if err := this.connect(); err != nil {
+				return err
+			}
+		}
+
+		if _, err := this.conn.Write([]byte(msg)); err != nil {
+			_ = this.conn.Close()
+			this.conn = nil
+			if i == 1 {
+				return err
+			}
+			continue
+		}
+		break
+	}
+
+	return nil
+}
+
+func (this *syslogSink) connect() error {
+	addrs := []string{this.addr}
+	if this.addr == "" {
+		addrs = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+	}
+
+	var err error
+	for _, addr := range addrs {
+		for _, network := range []string{"unixgram", "unix"} {
+			var c net.Conn
+			c, err = net.Dial(network, addr)
+			if err == nil {
+				this.conn = c
+				return nil
+			}
+		}
+	}
+
+	return err
+}
+
+func (this *syslogSink) Close() error {
+	this.Lock()
+	defer this.Unlock()
+
+	if this.conn == nil {
+		return nil
+	}
+
+	err := this.conn.Close()
+	this.conn = nil
+
+	return err
+}
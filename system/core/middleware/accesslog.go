@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"encoding/json"
+	"github.com/solaa51/gosab/system/core/app"
+	"github.com/solaa51/gosab/system/core/commonFunc"
+	"github.com/solaa51/gosab/system/core/myContext"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//访问日志 响应完成后记录一条 写入App.AccessLog 与应用日志分开
+//格式由app.toml的accessLogFormat配置:
+//combined Apache combined格式 末尾追加 耗时(秒) 请求ID
+//json 每行一个json对象
+//off 不记录
+//耗时从入口收到请求时开始计算 包含解析请求体的时间
+func AccessLog() myContext.HandlerFunc {
+	return func(ctx *myContext.Context) {
+		ctx.Next()
+
+		writeAccessLog(ctx.App, ctx.Request, ctx.Response, ctx.ClientIP, ctx.RequestId, ctx.Controller, ctx.Method)
+	}
+}
+
+//未进入中间件链的请求 如静态文件、405、未知路由 由入口调用记录访问日志
+func LogRequest(app *app.App, r *http.Request, w *myContext.ResponseWriter) {
+	writeAccessLog(app, r, w, commonFunc.ClientIP(r), r.Header.Get("X-Request-Id"), "", "")
+}
+
+func writeAccessLog(app *app.App, r *http.Request, w *myContext.ResponseWriter, ip, requestId, controller, action string) {
+	format := app.AccessLogFormat
+	if format == "off" || app.AccessLog == nil {
+		return
+	}
+
+	start := w.Start()
+	latency := time.Since(start)
+
+	var line []byte
+	if format == "json" {
+		line, _ = json.Marshal(map[string]interface{}{
+			"time":       start.Format("2006-01-02T15:04:05.000Z07:00"),
+			"ip":         ip,
+			"method":     r.Method,
+			"path":       r.URL.Path,
+			"query":      r.URL.RawQuery,
+			"proto":      r.Proto,
+			"status":     w.Status(),
+			"bytes":      w.Size(),
+			"latency_ms": float64(latency.Microseconds()) / 1000,
+			"referer":    r.Referer(),
+			"ua":         r.UserAgent(),
+			"request_id": requestId,
+			"controller": controller,
+			"action":     action,
+		})
+		line = append(line, '\n')
+	} else {
+		if ip == "" { //unix socket请求没有客户端地址
+			ip = "-"
+		}
+		if requestId == "" {
+			requestId = "-"
+		}
+		line = []byte(ip + " - - [" + start.Format("02/Jan/2006:15:04:05 -0700") + "] " +
+			quote(r.Method+" "+r.RequestURI+" "+r.Proto) + " " +
+			strconv.Itoa(w.Status()) + " " + strconv.FormatInt(w.Size(), 10) + " " +
+			quote(r.Referer()) + " " + quote(r.UserAgent()) + " " +
+			strconv.FormatFloat(latency.Seconds(), 'f', 6, 64) + " " + requestId + "\n")
+	}
+
+	_, _ = app.AccessLog.Write(line)
+}
+
+//combined格式的引号字段 空值为"-"
+func quote(s string) string {
+	if s == "" {
+		return `"-"`
+	}
+
+	return `"` + strings.Replace(s, `"`, `\"`, -1) + `"`
+}
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/solaa51/gosab/system/core/app"
+	"github.com/solaa51/gosab/system/core/myContext"
+)
+
+/**
+按控制器执行客户端证书策略 见app.toml中[clientCert]
+required: 未提供经CA验证的客户端证书时返回403
+optional: 提供时可通过ctx.ClientCert获取身份
+off: 忽略客户端证书 ctx.ClientCert为nil
+*/
+func ClientCert() myContext.HandlerFunc {
+	return func(ctx *myContext.Context) {
+		switch ctx.App.ClientCertPolicy(ctx.Controller) {
+		case app.ClientCertOptional:
+		case app.ClientCertOff:
+			ctx.ClientCert = nil
+		default: //未知的配置按required处理
+			if ctx.ClientCert == nil {
+				http.Error(ctx.Writer, "需要有效的客户端证书", http.StatusForbidden)
+				ctx.Abort()
+			}
+		}
+	}
+}
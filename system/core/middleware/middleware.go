@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"github.com/solaa51/gosab/system/core/myContext"
+	"net/http"
+	"time"
+)
+
+/**
+框架内置中间件
+通过 router.Use 全局使用, router.UseController 按控制器使用, router.GET(...).Use 按路由使用
+
+使用方法:
+	router.Use(middleware.AccessLog(), middleware.Recovery(), middleware.IpCheck(), middleware.ClientCert(), middleware.SignCheck(), middleware.RateLimit())
+*/
+
+//验证ip是否可访问 规则见App.IpClass
+func IpCheck() myContext.HandlerFunc {
+	return func(ctx *myContext.Context) {
+		if !ctx.App.IpClass(ctx.Controller, ctx.ClientIP) {
+			http.Error(ctx.Writer, "受限的ip访问: "+ctx.ClientIP, http.StatusForbidden)
+			ctx.Abort()
+		}
+	}
+}
+
+//签名检查 并将需要签名的参数 拆分参数为公共参数和业务参数
+func SignCheck() myContext.HandlerFunc {
+	return func(ctx *myContext.Context) {
+		b, err := ctx.SignCheck()
+		if !b {
+			http.Error(ctx.Writer, err.Error(), http.StatusBadGateway)
+			ctx.Abort()
+		}
+	}
+}
+
+//记录后续处理的执行时间 写入应用日志 访问日志中已包含执行时间 需要单独统计时使用
+func Timing() myContext.HandlerFunc {
+	return func(ctx *myContext.Context) {
+		start := time.Now()
+		ctx.Next()
+		ctx.Log.Trace("run time:" + ctx.Controller + "/" + ctx.Method + "--" + time.Since(start).String())
+	}
+}
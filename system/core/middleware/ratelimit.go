@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/solaa51/gosab/system/core/limiter"
+	"github.com/solaa51/gosab/system/core/myContext"
+)
+
+/**
+按app.toml中的[[limit]]规则限流 超出时返回429并通过Retry-After告知重试等待秒数
+app_key维度取自验签后的公共参数 需放在SignCheck之后
+*/
+func RateLimit() myContext.HandlerFunc {
+	return func(ctx *myContext.Context) {
+		ok, wait := ctx.App.Limiter.Allow(limiter.Keys{
+			Ip:         ctx.ClientIP,
+			AppKey:     ctx.CommonParam.AppKey,
+			Controller: ctx.Controller,
+			Method:     ctx.Method,
+		})
+		if ok {
+			return
+		}
+
+		retry := int64(math.Ceil(wait.Seconds()))
+		if retry < 1 {
+			retry = 1
+		}
+
+		ctx.Writer.Header().Set("Retry-After", strconv.FormatInt(retry, 10))
+		http.Error(ctx.Writer, "请求过于频繁 请稍后再试", http.StatusTooManyRequests)
+		ctx.Abort()
+	}
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/solaa51/gosab/system/core/app"
+	"github.com/solaa51/gosab/system/core/limiter"
+	slog "github.com/solaa51/gosab/system/core/log"
+	"github.com/solaa51/gosab/system/core/myContext"
+)
+
+//按约定路由解析出的方法首字母为大写 配置中的小写方法名同样生效
+func TestRateLimitMatchesContextMethod(t *testing.T) {
+	set, err := limiter.NewSet([]limiter.Rule{
+		{Key: limiter.KeyIp, Algorithm: limiter.AlgorithmWindow, Limit: 1, Window: 60, Controller: "order", Method: "create"},
+	}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &app.App{Limiter: set, Log: slog.NewLog("dev", "")}
+
+	serve := func(path string) int {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+
+		ctx, err := myContext.NewContext(r, w, a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx.Run(RateLimit(), func(ctx *myContext.Context) {
+			ctx.Writer.WriteHeader(http.StatusOK)
+		})
+
+		return w.Code
+	}
+
+	if code := serve("/order/create"); code != http.StatusOK {
+		t.Fatalf("first request = %d, want 200", code)
+	}
+	if code := serve("/order/create"); code != http.StatusTooManyRequests {
+		t.Fatalf("second request = %d, want 429", code)
+	}
+
+	//其他方法不受该规则限制
+	for i := 0; i < 3; i++ {
+		if code := serve("/order/list"); code != http.StatusOK {
+			t.Fatalf("/order/list = %d, want 200", code)
+		}
+	}
+}
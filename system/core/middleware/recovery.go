@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"fmt"
+	"github.com/solaa51/gosab/system/core/myContext"
+	"net/http"
+	"runtime/debug"
+)
+
+//捕获后续处理中的panic 记录错误日志及调用栈 并返回json格式的错误信息
+//返回格式与ctx.JsonReturn一致 ret和msg可在app.toml中通过panicRet panicMsg配置
+//本地环境(env=local)下 data中会包含调用栈 便于调试
+//panic前已输出部分响应时 只记录日志 不再追加错误信息
+func Recovery() myContext.HandlerFunc {
+	return func(ctx *myContext.Context) {
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+
+			//net/http约定的中断请求 交由http服务处理
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+
+			ctx.Abort()
+
+			stack := string(debug.Stack())
+			ctx.App.Log.Error(fmt.Sprintf("panic: %v request_id:%s %s/%s\n%s", err, ctx.RequestId, ctx.Controller, ctx.Method, stack))
+
+			//已开始输出响应 无法再返回错误信息 只记录日志
+			if ctx.Response.Written() {
+				return
+			}
+
+			ret := ctx.App.PanicRet
+			if ret == 0 {
+				ret = http.StatusInternalServerError
+			}
+
+			msg := ctx.App.PanicMsg
+			if msg == "" {
+				msg = "服务器内部错误"
+			}
+
+			var data interface{} = ""
+			if ctx.App.ENV == "local" {
+				data = map[string]string{
+					"panic":      fmt.Sprint(err),
+					"request_id": ctx.RequestId,
+					"stack":      stack,
+				}
+			}
+
+			ctx.JsonStatusReturn(http.StatusInternalServerError, ret, data, "%s", msg) //msg为配置内容 不作为格式串
+		}()
+
+		ctx.Next()
+	}
+}
@@ -0,0 +1,66 @@
+package myContext
+
+import (
+	"crypto/x509"
+	"net/http"
+	"strings"
+)
+
+//已验证的客户端证书身份 用于双向tls的内部服务调用
+type ClientIdentity struct {
+	CommonName string
+	DNSNames   []string
+	Emails     []string
+	URIs       []string
+	IPs        []string
+
+	Cert *x509.Certificate
+}
+
+//从请求中获取已通过CA验证的客户端证书 未提供时返回nil
+func clientIdentity(r *http.Request) *ClientIdentity {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	cert := r.TLS.VerifiedChains[0][0]
+	id := &ClientIdentity{
+		CommonName: cert.Subject.CommonName,
+		DNSNames:   cert.DNSNames,
+		Emails:     cert.EmailAddresses,
+		Cert:       cert,
+	}
+	for _, u := range cert.URIs {
+		id.URIs = append(id.URIs, u.String())
+	}
+	for _, ip := range cert.IPAddresses {
+		id.IPs = append(id.IPs, ip.String())
+	}
+
+	return id
+}
+
+//CN或任一SAN与name相同 域名不区分大小写
+func (this *ClientIdentity) Match(name string) bool {
+	if this == nil {
+		return false
+	}
+
+	if strings.EqualFold(this.CommonName, name) {
+		return true
+	}
+	for _, v := range this.DNSNames {
+		if strings.EqualFold(v, name) {
+			return true
+		}
+	}
+	for _, list := range [][]string{this.Emails, this.URIs, this.IPs} {
+		for _, v := range list {
+			if v == name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -1,16 +1,20 @@
 package myContext
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/solaa51/gosab/system/core/app"
 	"github.com/solaa51/gosab/system/core/commonFunc"
+	"github.com/solaa51/gosab/system/core/db"
 	"github.com/solaa51/gosab/system/core/log"
+	"math"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 	"unicode/utf8"
 
 	"github.com/gorilla/websocket"
@@ -19,12 +23,16 @@ import (
 type Context struct {
 	App *app.App
 
-	Request *http.Request
-	Writer  http.ResponseWriter
-	Header  http.Header
+	Request  *http.Request
+	Writer   http.ResponseWriter
+	Response *ResponseWriter //与Writer为同一个 可获取状态码及输出大小
+	Header   http.Header
 
 	Controller string
 	Method     string
+	ClientIP   string          //客户端ip
+	RequestId  string          //请求ID 优先使用请求头X-Request-Id
+	ClientCert *ClientIdentity //已验证的客户端证书身份 未提供或策略为off时为nil
 
 	Log *log.NLog //记录日志使用
 
@@ -33,12 +41,28 @@ type Context struct {
 
 	CommonParam CommonParam //公共参数 验证签名的请求使用
 	YewuParam   YewuParam   //业务参数 验证签名的请求使用
+
+	params map[string]string //路由表中捕获的路径参数
+
+	handlers []HandlerFunc //中间件及最终处理函数
+	index    int           //当前执行到的位置
 }
 
-//初始化 上下文请求信息
+//中间件及请求处理函数
+type HandlerFunc func(ctx *Context)
+
+//中断执行时的位置 足够大即可
+const abortIndex = math.MaxInt32
+
+//初始化 上下文请求信息 按 /控制器/方法 约定解析路由
 func NewContext(r *http.Request, w http.ResponseWriter, app *app.App) (*Context, error) {
-	uri := r.RequestURI
+	cClass, cMethod := ParseUri(r.URL.Path)
 
+	return NewRouteContext(r, w, app, cClass, cMethod, nil)
+}
+
+//按 /控制器/方法 约定解析出控制器和方法
+func ParseUri(uri string) (string, string) {
 	defaultClass := "welcome"
 	defaultMethod := "Index"
 	cClass := ""
@@ -60,40 +84,78 @@ func NewContext(r *http.Request, w http.ResponseWriter, app *app.App) (*Context,
 		}
 	}
 
+	return cClass, cMethod
+}
+
+//初始化 上下文请求信息 控制器和方法由路由表匹配得出
+//params 为路由中捕获的路径参数
+func NewRouteContext(r *http.Request, w http.ResponseWriter, app *app.App, cClass, cMethod string, params map[string]string) (*Context, error) {
+	response := NewResponseWriter(w)
 	context := &Context{
 		App:        app,
 		Request:    r,
-		Writer:     w,
+		Writer:     response,
+		Response:   response,
 		Controller: cClass,
 		Method:     cMethod,
-		Log:        app.Log,
+		ClientIP:   commonFunc.ClientIP(r),
+		RequestId:  requestId(r),
+		ClientCert: clientIdentity(r),
+		params:     params,
 	}
 
+	//请求ID 放入请求的context 并通过响应头返回
+	context.Request = r.WithContext(commonFunc.WithRequestId(r.Context(), context.RequestId))
+	w.Header().Set("X-Request-Id", context.RequestId)
+
+	//本次请求的日志 自动附带请求信息
+	context.Log = app.Log.With("request_id", context.RequestId).With("ip", context.ClientIP).With("controller", cClass).With("method", cMethod)
+
 	//解析请求参数
 	context.parseForm()
 
-	ip := commonFunc.ClientIP(r)
-
-	//记录访问日志
-	context.Log.Info(ip + ":" + cClass + "/" + cMethod + "--" + r.Header.Get("User-Agent"))
+	return context, nil
+}
 
-	//验证ip是否可访问
-	if !app.IpClass(cClass, ip) {
-		_, _ = fmt.Fprintf(w, string("受限的ip访问: "+ip))
-		return nil, errors.New("受限的ip访问: " + ip)
+//请求ID 请求头中不存在时生成一个
+func requestId(r *http.Request) string {
+	id := strings.TrimSpace(r.Header.Get("X-Request-Id"))
+	if id != "" && len(id) <= 128 {
+		return id
 	}
 
-	//签名检查 检查是否验证签名信息
-	b, err := context.signCheck()
-	if !b {
-		return nil, err
+	return commonFunc.UniqueId()
+}
+
+//按顺序执行中间件及最终处理函数
+func (this *Context) Run(handlers ...HandlerFunc) {
+	this.handlers = handlers
+	this.index = -1
+	this.Next()
+}
+
+//在中间件中调用 执行后续的中间件及处理函数 执行完毕后返回当前中间件
+//中间件未调用Next时 当前中间件返回后 自动执行后续处理
+func (this *Context) Next() {
+	this.index++
+	for this.index < len(this.handlers) {
+		this.handlers[this.index](this)
+		this.index++
 	}
+}
 
-	return context, nil
+//中断后续中间件及处理函数的执行 已执行的中间件仍会正常返回
+func (this *Context) Abort() {
+	this.index = abortIndex
+}
+
+//是否已中断执行
+func (this *Context) IsAborted() bool {
+	return this.index >= abortIndex
 }
 
 //签名检查 并将需要签名的参数 拆分参数为公共参数和业务参数
-func (this *Context) signCheck() (bool, error) {
+func (this *Context) SignCheck() (bool, error) {
 	if !this.App.SIGNCHECK { //不需要检查
 		return true, errors.New("不用检查")
 	}
@@ -132,6 +194,9 @@ type CommonParam struct {
 	Method     string    `json:"method"`
 	FromSource int64     `json:"from_source"`
 	Ip         string    `json:"ip"`
+	Timestamp  int64     `json:"timestamp"` //请求时间戳 秒
+	Nonce      string    `json:"nonce"`     //随机字符串 有效期内不可重复
+	SignType   string    `json:"sign_type"` //签名方式 hmac(默认) md5
 	Sign       string    `json:"sign"`
 	Param      YewuParam `json:"param"` //业务参数部分
 }
@@ -160,19 +225,64 @@ func (this *Context) exParam(exParam string) error {
 		return errors.New("IP不能为空")
 	}
 
+	if data.Timestamp == 0 {
+		return errors.New("timestamp不能为空")
+	}
+
+	if data.Nonce == "" {
+		return errors.New("nonce不能为空")
+	}
+
 	if data.Sign == "" {
 		return errors.New("签名不能为空")
 	}
 
-	this.CommonParam = data
-	this.YewuParam = data.Param
+	//签名只对指定的控制器和方法有效 防止签名被用于其他接口
+	if data.Control != this.Controller || strings.ToUpper(data.Method[:1])+data.Method[1:] != this.Method {
+		return errors.New("签名与请求的接口不一致")
+	}
+
+	secret, ok := this.App.SignKeys[data.AppKey]
+	if !ok || secret == "" {
+		return errors.New("无效的app_key")
+	}
+
+	signType := commonFunc.SignHmac
+	if data.SignType == commonFunc.SignMd5 {
+		if !this.App.SignMd5 {
+			return errors.New("不支持的签名方式")
+		}
+		signType = commonFunc.SignMd5
+	}
+
+	expire := this.App.SignExpire
+	if expire <= 0 {
+		expire = 300
+	}
+
+	now := commonFunc.Time()
+	if data.Timestamp < now-expire || data.Timestamp > now+expire {
+		return errors.New("请求已过期")
+	}
 
-	//TODO 生成签名比较对错
-	/*if data.Sign != this.sign() {
+	//按原始参数生成签名 比较对错
+	raw := make(map[string]interface{})
+	if err = json.Unmarshal([]byte(exParam), &raw); err != nil {
+		return err
+	}
+	rawParam, _ := raw["param"].(map[string]interface{})
+
+	if !commonFunc.SignEqual(data.Sign, this.sign(signType, secret, raw, rawParam)) {
 		return errors.New("签名不匹配")
-	}*/
+	}
 
-	//TODO 可以用来记录日志
+	//签名正确后再记录nonce 防止伪造请求占用nonce
+	if !this.App.UseNonce(data.AppKey+":"+data.Nonce, time.Duration(expire*2)*time.Second) {
+		return errors.New("重复的请求")
+	}
+
+	this.CommonParam = data
+	this.YewuParam = data.Param
 
 	return nil
 }
@@ -188,9 +298,34 @@ func (this *Context) WebSocket() (*websocket.Conn, error) {
 	return conn, err
 }
 
-//TODO 生成签名参数
-func (this *Context) sign() string {
-	return ""
+//生成签名参数 规则见commonFunc.SignString
+func (this *Context) sign(signType, secret string, common map[string]interface{}, param map[string]interface{}) string {
+	return commonFunc.Sign(signType, secret, commonFunc.SignString(common, param))
+}
+
+//本次请求的context 包含请求ID 发起请求时传入可传递请求ID
+//如 commonFunc.GetPostContext(ctx.Context(), "GET", url, nil, nil, nil)
+func (this *Context) Context() context.Context {
+	return this.Request.Context()
+}
+
+//获取数据库连接 不传名称时使用default 未配置时返回nil
+func (this *Context) DB(name ...string) *db.DB {
+	if len(name) > 0 {
+		return this.App.DB.Get(name[0])
+	}
+
+	return this.App.DB.Get("")
+}
+
+//按逻辑表名获取分库分表 未配置时返回nil
+func (this *Context) Shard(name string) *db.Shard {
+	return this.App.DB.Shard(name)
+}
+
+//获取路由表中捕获的路径参数 如 /users/:id 中的id
+func (this *Context) PathParam(name string) string {
+	return this.params[name]
 }
 
 func (this *Context) GetParam(param string) string {
@@ -411,10 +546,15 @@ type JsonErr struct {
 }
 
 func (this *Context) JsonReturn(code int, data interface{}, format string, a ...interface{}) {
+	this.JsonStatusReturn(http.StatusOK, code, data, format, a...)
+}
+
+//json返回数据 并指定http状态码
+func (this *Context) JsonStatusReturn(status int, code int, data interface{}, format string, a ...interface{}) {
 	msg := ""
 
 	if strings.Contains(format, "%s") || strings.Contains(format, "%d") || strings.Contains(format, "%v") || strings.Contains(format, "%t") {
-		msg = fmt.Sprintf(format, a)
+		msg = fmt.Sprintf(format, a...)
 	} else {
 		msg = format
 	}
@@ -429,7 +569,10 @@ func (this *Context) JsonReturn(code int, data interface{}, format string, a ...
 
 	header := this.Writer.Header()
 	header.Set("Content-Type", "application/json;charset=UTF-8")
-	_, _ = fmt.Fprintf(this.Writer, string(b))
+	if status != http.StatusOK {
+		this.Writer.WriteHeader(status)
+	}
+	_, _ = this.Writer.Write(b)
 }
 
 //txt内容直接返回
@@ -439,12 +582,12 @@ func (this *Context) TxtReturn(code int64, format string, a ...interface{}) {
 	msg := ""
 
 	if strings.Contains(format, "%s") || strings.Contains(format, "%d") || strings.Contains(format, "%v") || strings.Contains(format, "%t") {
-		msg = fmt.Sprintf(format, a)
+		msg = fmt.Sprintf(format, a...)
 	} else {
 		msg = format
 	}
 
 	str := strconv.FormatInt(code, 10) + "|" + msg
 
-	_, _ = fmt.Fprintf(this.Writer, str)
+	_, _ = fmt.Fprint(this.Writer, str)
 }
@@ -0,0 +1,92 @@
+package myContext
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+//记录状态码和输出大小的ResponseWriter 用于访问日志
+//保留Hijacker Flusher 不影响websocket和流式输出
+type ResponseWriter struct {
+	http.ResponseWriter
+	status int
+	size   int64
+	start  time.Time
+}
+
+//在收到请求时创建 访问日志的耗时从此时开始计算 包含读取请求体的时间
+func NewResponseWriter(w http.ResponseWriter) *ResponseWriter {
+	if rw, ok := w.(*ResponseWriter); ok {
+		return rw
+	}
+
+	return &ResponseWriter{ResponseWriter: w, start: time.Now()}
+}
+
+func (this *ResponseWriter) WriteHeader(code int) {
+	if this.status == 0 {
+		this.status = code
+	}
+	this.ResponseWriter.WriteHeader(code)
+}
+
+func (this *ResponseWriter) Write(b []byte) (int, error) {
+	if this.status == 0 {
+		this.status = http.StatusOK
+	}
+
+	n, err := this.ResponseWriter.Write(b)
+	this.size += int64(n)
+
+	return n, err
+}
+
+//响应状态码 未输出时为200
+func (this *ResponseWriter) Status() int {
+	if this.status == 0 {
+		return http.StatusOK
+	}
+
+	return this.status
+}
+
+//已输出的响应体大小
+func (this *ResponseWriter) Size() int64 {
+	return this.size
+}
+
+//开始处理请求的时间
+func (this *ResponseWriter) Start() time.Time {
+	return this.start
+}
+
+//是否已输出响应头
+func (this *ResponseWriter) Written() bool {
+	return this.status != 0
+}
+
+func (this *ResponseWriter) Flush() {
+	if f, ok := this.ResponseWriter.(http.Flusher); ok {
+		if this.status == 0 {
+			this.status = http.StatusOK
+		}
+		f.Flush()
+	}
+}
+
+//websocket升级使用
+func (this *ResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := this.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("ResponseWriter不支持Hijack")
+	}
+
+	if this.status == 0 {
+		this.status = http.StatusSwitchingProtocols
+	}
+
+	return h.Hijack()
+}
@@ -0,0 +1,170 @@
+package myContext
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/solaa51/gosab/system/core/app"
+	"github.com/solaa51/gosab/system/core/commonFunc"
+	slog "github.com/solaa51/gosab/system/core/log"
+)
+
+func signApp() *app.App {
+	return &app.App{
+		SIGNCHECK: true,
+		SignKeys:  map[string]string{"k": "secret"},
+		Log:       slog.NewLog("dev", ""),
+	}
+}
+
+//以post的param字段提交到path 返回验签结果
+func checkSign(t *testing.T, a *app.App, path, param string) error {
+	t.Helper()
+
+	body := url.Values{"param": {param}}.Encode()
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	ctx, err := NewContext(r, httptest.NewRecorder(), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ctx.SignCheck()
+	return err
+}
+
+func mustSign(t *testing.T, signType, control, method string, param map[string]interface{}) string {
+	t.Helper()
+
+	s, err := commonFunc.SignParam("k", "secret", signType, control, method, param)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+//修改已签名的参数 不重新签名
+func tamper(t *testing.T, s string, fn func(data map[string]interface{})) string {
+	t.Helper()
+
+	data := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(s), &data); err != nil {
+		t.Fatal(err)
+	}
+	fn(data)
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(b)
+}
+
+func expectErr(t *testing.T, err error, want string) {
+	t.Helper()
+
+	if err == nil || err.Error() != want {
+		t.Fatalf("SignCheck error = %v, want %q", err, want)
+	}
+}
+
+func TestSignRoundTrip(t *testing.T) {
+	a := signApp()
+
+	//小数及null按服务端解析出的值参与签名
+	param := map[string]interface{}{"price": 1.001, "amount": 10.5, "note": nil, "empty": "", "tags": []string{"a", "b"}}
+	s := mustSign(t, "", "order", "create", param)
+
+	if err := checkSign(t, a, "/order/create", s); err != nil {
+		t.Fatal(err)
+	}
+
+	//同一nonce不能再次使用
+	expectErr(t, checkSign(t, a, "/order/create", s), "重复的请求")
+}
+
+func TestSignTampered(t *testing.T) {
+	a := signApp()
+	s := mustSign(t, "", "order", "create", map[string]interface{}{"amount": 1.5, "note": nil})
+
+	cases := map[string]func(data map[string]interface{}){
+		"amount": func(data map[string]interface{}) {
+			data["param"].(map[string]interface{})["amount"] = 1.50001
+		},
+		"null to empty": func(data map[string]interface{}) {
+			data["param"].(map[string]interface{})["note"] = ""
+		},
+		"extra param": func(data map[string]interface{}) {
+			data["param"].(map[string]interface{})["admin"] = 1
+		},
+		"nonce": func(data map[string]interface{}) {
+			data["nonce"] = "other"
+		},
+	}
+	for name, fn := range cases {
+		if err := checkSign(t, a, "/order/create", tamper(t, s, fn)); err == nil || err.Error() != "签名不匹配" {
+			t.Fatalf("%s: SignCheck error = %v, want 签名不匹配", name, err)
+		}
+	}
+
+	//篡改失败的请求不占用nonce
+	if err := checkSign(t, a, "/order/create", s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//签名只对指定的控制器和方法有效
+func TestSignEndpoint(t *testing.T) {
+	a := signApp()
+	s := mustSign(t, "", "order", "create", nil)
+
+	expectErr(t, checkSign(t, a, "/user/create", s), "签名与请求的接口不一致")
+	expectErr(t, checkSign(t, a, "/order/delete", s), "签名与请求的接口不一致")
+
+	//方法名首字母大小写不影响
+	if err := checkSign(t, a, "/order/Create", s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSignExpired(t *testing.T) {
+	a := signApp()
+	a.SignExpire = 60
+
+	s := mustSign(t, "", "order", "create", nil)
+	for _, offset := range []int64{-61, 61} {
+		old := tamper(t, s, func(data map[string]interface{}) {
+			data["timestamp"] = commonFunc.Time() + offset
+		})
+		expectErr(t, checkSign(t, a, "/order/create", old), "请求已过期")
+	}
+}
+
+func TestSignMd5(t *testing.T) {
+	a := signApp()
+
+	s := mustSign(t, commonFunc.SignMd5, "order", "create", map[string]interface{}{"a": 1})
+	expectErr(t, checkSign(t, a, "/order/create", s), "不支持的签名方式")
+
+	a.SignMd5 = true
+	if err := checkSign(t, a, "/order/create", s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSignInvalidKey(t *testing.T) {
+	a := signApp()
+
+	s, err := commonFunc.SignParam("unknown", "secret", "", "order", "create", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectErr(t, checkSign(t, a, "/order/create", s), "无效的app_key")
+}
@@ -0,0 +1,63 @@
+package router
+
+import (
+	"github.com/solaa51/gosab/system/core/myContext"
+	"sync"
+)
+
+/**
+中间件注册
+执行顺序: 全局中间件 -> 控制器中间件 -> 路由中间件 -> 控制器方法
+中间件中调用ctx.Next()执行后续处理 调用ctx.Abort()中断后续处理
+路由中间件只对经路由表匹配的请求生效 约定路由访问不到路由表中声明的方法
+未在路由表声明的方法需要鉴权时 使用控制器中间件
+*/
+
+var (
+	mwLock            sync.RWMutex
+	globalMiddlewares []myContext.HandlerFunc
+	classMiddlewares  = make(map[string][]myContext.HandlerFunc)
+)
+
+//添加全局中间件 对所有动态请求生效
+func Use(middlewares ...myContext.HandlerFunc) {
+	mwLock.Lock()
+	defer mwLock.Unlock()
+
+	globalMiddlewares = append(globalMiddlewares, middlewares...)
+}
+
+//添加控制器中间件 仅对该控制器的请求生效
+func UseController(name string, middlewares ...myContext.HandlerFunc) {
+	mwLock.Lock()
+	defer mwLock.Unlock()
+
+	classMiddlewares[name] = append(classMiddlewares[name], middlewares...)
+}
+
+//添加路由中间件 仅对经该路由匹配的请求生效
+func (this *Route) Use(middlewares ...myContext.HandlerFunc) *Route {
+	routeLock.Lock()
+	defer routeLock.Unlock()
+
+	this.middlewares = append(this.middlewares, middlewares...)
+
+	return this
+}
+
+//组装本次请求需要执行的处理链 route为nil表示按约定路由处理
+func Handlers(ctx *myContext.Context, route *Route, final myContext.HandlerFunc) []myContext.HandlerFunc {
+	mwLock.RLock()
+	handlers := make([]myContext.HandlerFunc, 0, len(globalMiddlewares)+len(classMiddlewares[ctx.Controller])+1)
+	handlers = append(handlers, globalMiddlewares...)
+	handlers = append(handlers, classMiddlewares[ctx.Controller]...)
+	mwLock.RUnlock()
+
+	if route != nil {
+		routeLock.RLock()
+		handlers = append(handlers, route.middlewares...)
+		routeLock.RUnlock()
+	}
+
+	return append(handlers, final)
+}
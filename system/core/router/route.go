@@ -0,0 +1,336 @@
+package router
+
+import (
+	"errors"
+	"github.com/solaa51/gosab/system/core/myContext"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+声明式路由表
+支持的路由格式:
+	/users/:id            :id 匹配一段路径 通过ctx.PathParam("id")获取
+	/files/*path          *path 匹配剩余的全部路径 只能放在最后
+路由指向 控制器+方法 未匹配路由表时 仍按 /控制器/方法 约定处理
+已在路由表中声明的 控制器+方法 只能通过路由表访问 约定路由不再调用
+避免绕过路由的请求方法限制、路径参数、超时及路由中间件
+
+使用方法:
+	func init() {
+		router.GET("/users/:id/orders/*rest", "user", "Orders")
+		router.POST("/users/:id", "user", "Update")
+	}
+*/
+
+//匹配任意http方法
+const AnyMethod = "*"
+
+var (
+	ErrMethodNotAllowed = errors.New("请求方法不被允许")
+	ErrNotFound         = errors.New("碰到了不认识的路由")
+)
+
+//路由段类型 值越小 匹配优先级越高
+const (
+	segStatic = iota
+	segParam
+	segWildcard
+)
+
+type segment struct {
+	kind  int
+	value string //静态段为路径内容 参数段为参数名
+}
+
+//一条路由规则
+type Route struct {
+	Method     string //http方法 *表示任意方法
+	Pattern    string //路由格式
+	Controller string //控制器名称 对应router.Register的名称
+	Action     string //控制器方法名 如 Index
+
+	segments     []segment
+	middlewares  []myContext.HandlerFunc //路由中间件
+	readTimeout  time.Duration           //路由的读超时 0使用服务默认值
+	writeTimeout time.Duration           //路由的写超时 0使用服务默认值
+}
+
+var (
+	routeLock sync.RWMutex
+	routes    []*Route
+	bound     = make(map[string]bool) //路由表中声明过的 控制器/方法
+)
+
+//添加一条路由规则 格式错误时直接panic 便于启动阶段暴露问题
+func Handle(method, pattern, controller, action string) *Route {
+	if method == "" {
+		method = AnyMethod
+	}
+
+	if controller == "" || action == "" {
+		panic("router: 路由必须指定控制器和方法: " + pattern)
+	}
+
+	route := &Route{
+		Method:     strings.ToUpper(method),
+		Pattern:    pattern,
+		Controller: controller,
+		Action:     action,
+		segments:   parsePattern(pattern),
+	}
+
+	routeLock.Lock()
+	defer routeLock.Unlock()
+
+	for _, v := range routes {
+		if v.Method == route.Method && v.Pattern == route.Pattern {
+			panic("router: 重复的路由: " + route.Method + " " + pattern)
+		}
+	}
+
+	routes = append(routes, route)
+	bound[controller+"/"+action] = true
+
+	return route
+}
+
+func GET(pattern, controller, action string) *Route {
+	return Handle(http.MethodGet, pattern, controller, action)
+}
+
+func POST(pattern, controller, action string) *Route {
+	return Handle(http.MethodPost, pattern, controller, action)
+}
+
+func PUT(pattern, controller, action string) *Route {
+	return Handle(http.MethodPut, pattern, controller, action)
+}
+
+func PATCH(pattern, controller, action string) *Route {
+	return Handle(http.MethodPatch, pattern, controller, action)
+}
+
+func DELETE(pattern, controller, action string) *Route {
+	return Handle(http.MethodDelete, pattern, controller, action)
+}
+
+//任意http方法
+func ANY(pattern, controller, action string) *Route {
+	return Handle(AnyMethod, pattern, controller, action)
+}
+
+//设置路由的读写超时 0使用服务默认值 小于0不限制 用于长轮询、websocket、上传等
+//app.toml中[timeouts]的配置优先 只对HTTP/1.x请求生效 HTTP/2请求使用服务默认值
+//	router.GET("/chat/poll", "chat", "Poll").Timeout(0, -1)
+func (this *Route) Timeout(read, write time.Duration) *Route {
+	routeLock.Lock()
+	defer routeLock.Unlock()
+
+	this.readTimeout = read
+	this.writeTimeout = write
+
+	return this
+}
+
+//路由的读写超时
+func (this *Route) Timeouts() (read, write time.Duration) {
+	routeLock.RLock()
+	defer routeLock.RUnlock()
+
+	return this.readTimeout, this.writeTimeout
+}
+
+//控制器方法是否已在路由表中声明 已声明的不允许按约定路由访问
+func Bound(controller, action string) bool {
+	routeLock.RLock()
+	defer routeLock.RUnlock()
+
+	return bound[controller+"/"+action]
+}
+
+//按请求方法和路径匹配路由
+//未匹配到任何路由时 返回nil 由调用方按约定路由处理
+//路径匹配但方法不匹配时 返回ErrMethodNotAllowed
+func Match(method, path string) (*Route, map[string]string, error) {
+	parts := splitPath(path)
+
+	routeLock.RLock()
+	defer routeLock.RUnlock()
+
+	var best *Route
+	var bestParams map[string]string
+	pathMatched := false
+	for _, v := range routes {
+		params, ok := v.match(parts)
+		if !ok {
+			continue
+		}
+		pathMatched = true
+
+		if !v.allow(method) {
+			continue
+		}
+
+		if best == nil || v.before(best, method) {
+			best = v
+			bestParams = params
+		}
+	}
+
+	if best == nil && pathMatched {
+		return nil, nil, ErrMethodNotAllowed
+	}
+
+	return best, bestParams, nil
+}
+
+//解析请求对应的控制器和方法 优先匹配路由表 未匹配时按 /控制器/方法 约定处理
+//约定路由解析出的方法已在路由表中声明时 返回ErrNotFound
+//route为nil表示按约定路由处理
+func Resolve(method, path string) (route *Route, controller, action string, params map[string]string, err error) {
+	route, params, err = Match(method, path)
+	if err != nil {
+		return nil, "", "", nil, err
+	}
+
+	if route != nil {
+		return route, route.Controller, route.Action, params, nil
+	}
+
+	controller, action = myContext.ParseUri(path)
+	if Bound(controller, action) {
+		return nil, "", "", nil, ErrNotFound
+	}
+
+	return nil, controller, action, nil, nil
+}
+
+//路径可用的http方法 用于405响应的Allow头
+func Allowed(path string) []string {
+	parts := splitPath(path)
+
+	routeLock.RLock()
+	defer routeLock.RUnlock()
+
+	methods := make([]string, 0)
+	for _, v := range routes {
+		if _, ok := v.match(parts); ok && v.Method != AnyMethod {
+			methods = append(methods, v.Method)
+		}
+	}
+	sort.Strings(methods)
+
+	return methods
+}
+
+//解析路由格式
+func parsePattern(pattern string) []segment {
+	if !strings.HasPrefix(pattern, "/") {
+		panic("router: 路由必须以/开头: " + pattern)
+	}
+
+	//根路由没有路径段 其余路由不允许连续的/及末尾的/
+	parts := []string{}
+	if pattern != "/" {
+		parts = strings.Split(pattern[1:], "/")
+	}
+
+	segments := make([]segment, 0, len(parts))
+	for k, v := range parts {
+		if v == "" {
+			panic("router: 路由中有空的路径段: " + pattern)
+		}
+
+		switch v[0] {
+		case ':':
+			if len(v) == 1 {
+				panic("router: 路由参数缺少名称: " + pattern)
+			}
+			segments = append(segments, segment{kind: segParam, value: v[1:]})
+		case '*':
+			if len(v) == 1 {
+				panic("router: 路由参数缺少名称: " + pattern)
+			}
+			if k != len(parts)-1 {
+				panic("router: *参数只能放在路由最后: " + pattern)
+			}
+			segments = append(segments, segment{kind: segWildcard, value: v[1:]})
+		default:
+			segments = append(segments, segment{kind: segStatic, value: v})
+		}
+	}
+
+	return segments
+}
+
+//拆分路径 忽略首尾的/
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return []string{}
+	}
+
+	return strings.Split(path, "/")
+}
+
+//匹配路径 返回捕获的参数
+func (this *Route) match(parts []string) (map[string]string, bool) {
+	params := make(map[string]string)
+	for k, seg := range this.segments {
+		if seg.kind == segWildcard {
+			params[seg.value] = strings.Join(parts[k:], "/")
+			return params, true
+		}
+
+		if k >= len(parts) {
+			return nil, false
+		}
+
+		switch seg.kind {
+		case segStatic:
+			if seg.value != parts[k] {
+				return nil, false
+			}
+		case segParam:
+			params[seg.value] = parts[k]
+		}
+	}
+
+	if len(parts) != len(this.segments) {
+		return nil, false
+	}
+
+	return params, true
+}
+
+//是否允许该请求方法 HEAD请求可使用GET路由
+func (this *Route) allow(method string) bool {
+	switch this.Method {
+	case AnyMethod, method:
+		return true
+	case http.MethodGet:
+		return method == http.MethodHead
+	}
+
+	return false
+}
+
+//两条路由同时匹配时 判断当前路由是否优先
+//逐段比较 静态段优先于参数段 参数段优先于*参数 完全相同时 精确方法优先于任意方法
+func (this *Route) before(other *Route, method string) bool {
+	for k := 0; k < len(this.segments) && k < len(other.segments); k++ {
+		if this.segments[k].kind != other.segments[k].kind {
+			return this.segments[k].kind < other.segments[k].kind
+		}
+	}
+
+	if len(this.segments) != len(other.segments) {
+		return len(this.segments) > len(other.segments)
+	}
+
+	return this.Method == method && other.Method != method
+}
@@ -0,0 +1,80 @@
+package router
+
+import (
+	"github.com/solaa51/gosab/system/core/myContext"
+	"sort"
+	"sync"
+)
+
+/**
+控制器注册表
+控制器在自身包的init中注册 框架按名称查找并实例化 不再需要修改入口文件
+
+使用方法:
+	func init() {
+		router.Register("welcome", func(ctx *myContext.Context) interface{} {
+			return &Welcome{Ctx: ctx}
+		})
+	}
+*/
+
+//控制器工厂函数 每次请求实例化一个新的控制器 返回控制器的地址
+type Factory func(ctx *myContext.Context) interface{}
+
+var (
+	lock      sync.RWMutex
+	factories = make(map[string]Factory)
+)
+
+//注册控制器 名称重复或工厂函数为空时直接panic 便于启动阶段暴露问题
+func Register(name string, factory Factory) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if name == "" {
+		panic("router: 控制器名称不能为空")
+	}
+
+	if factory == nil {
+		panic("router: 控制器工厂函数不能为空: " + name)
+	}
+
+	if _, ok := factories[name]; ok {
+		panic("router: 重复注册的控制器: " + name)
+	}
+
+	factories[name] = factory
+}
+
+//按名称查找控制器工厂函数
+func Lookup(name string) (Factory, bool) {
+	lock.RLock()
+	defer lock.RUnlock()
+
+	f, ok := factories[name]
+	return f, ok
+}
+
+//按名称实例化控制器 不存在时返回nil
+func New(name string, ctx *myContext.Context) interface{} {
+	f, ok := Lookup(name)
+	if !ok {
+		return nil
+	}
+
+	return f(ctx)
+}
+
+//已注册的控制器名称 按名称排序
+func Names() []string {
+	lock.RLock()
+	defer lock.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for k := range factories {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,158 @@
+package router
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+//清空路由表 每个测试使用独立的路由
+func resetRoutes(t *testing.T) {
+	t.Helper()
+
+	routeLock.Lock()
+	defer routeLock.Unlock()
+
+	routes = nil
+	bound = make(map[string]bool)
+}
+
+func expectRoute(t *testing.T, method, path, action string, params map[string]string) {
+	t.Helper()
+
+	route, got, err := Match(method, path)
+	if err != nil {
+		t.Fatalf("Match(%s %s) error = %v", method, path, err)
+	}
+	if route == nil || route.Action != action {
+		t.Fatalf("Match(%s %s) = %+v, want action %s", method, path, route, action)
+	}
+	if len(got) != len(params) {
+		t.Fatalf("Match(%s %s) params = %v, want %v", method, path, got, params)
+	}
+	for k, v := range params {
+		if got[k] != v {
+			t.Fatalf("Match(%s %s) params = %v, want %v", method, path, got, params)
+		}
+	}
+}
+
+//静态段优先于参数段 参数段优先于*参数 与注册顺序无关
+func TestMatchPrecedence(t *testing.T) {
+	resetRoutes(t)
+
+	GET("/users/*rest", "user", "Rest")
+	GET("/users/:id", "user", "Show")
+	GET("/users/new", "user", "New")
+	GET("/users/:id/orders", "user", "Orders")
+
+	expectRoute(t, http.MethodGet, "/users/new", "New", map[string]string{})
+	expectRoute(t, http.MethodGet, "/users/5", "Show", map[string]string{"id": "5"})
+	expectRoute(t, http.MethodGet, "/users/5/orders", "Orders", map[string]string{"id": "5"})
+	expectRoute(t, http.MethodGet, "/users/5/orders/7", "Rest", map[string]string{"rest": "5/orders/7"})
+	expectRoute(t, http.MethodGet, "/users/", "Rest", map[string]string{"rest": ""})
+
+	if route, _, err := Match(http.MethodGet, "/orders/5"); route != nil || err != nil {
+		t.Fatalf("Match(/orders/5) = %+v, %v, want no route", route, err)
+	}
+}
+
+func TestMatchParams(t *testing.T) {
+	resetRoutes(t)
+
+	GET("/shops/:shop/goods/:id/*path", "shop", "Goods")
+
+	expectRoute(t, http.MethodGet, "/shops/s1/goods/100/img/a.png", "Goods",
+		map[string]string{"shop": "s1", "id": "100", "path": "img/a.png"})
+	expectRoute(t, http.MethodGet, "/shops/s1/goods/100", "Goods",
+		map[string]string{"shop": "s1", "id": "100", "path": ""})
+}
+
+func TestMatchMethod(t *testing.T) {
+	resetRoutes(t)
+
+	GET("/items/:id", "item", "Show")
+	PUT("/items/:id", "item", "Update")
+	DELETE("/items/:id", "item", "Delete")
+	ANY("/ping", "ping", "Any")
+	POST("/ping", "ping", "Post")
+
+	expectRoute(t, http.MethodPut, "/items/1", "Update", map[string]string{"id": "1"})
+
+	//HEAD请求使用GET路由
+	expectRoute(t, http.MethodHead, "/items/1", "Show", map[string]string{"id": "1"})
+
+	//路径匹配但方法不匹配时返回405 Allow头列出可用的方法
+	if _, _, err := Match(http.MethodPost, "/items/1"); err != ErrMethodNotAllowed {
+		t.Fatalf("POST /items/1 error = %v, want ErrMethodNotAllowed", err)
+	}
+	if got := strings.Join(Allowed("/items/1"), ", "); got != "DELETE, GET, PUT" {
+		t.Fatalf("Allowed = %s", got)
+	}
+
+	//相同路径 精确方法优先于任意方法
+	expectRoute(t, http.MethodPost, "/ping", "Post", map[string]string{})
+	expectRoute(t, http.MethodGet, "/ping", "Any", map[string]string{})
+}
+
+//约定路由不能访问已在路由表中声明的方法
+func TestResolveConventionFallback(t *testing.T) {
+	resetRoutes(t)
+
+	GET("/users/:id/orders", "user", "Orders")
+
+	route, controller, action, params, err := Resolve(http.MethodGet, "/users/5/orders")
+	if err != nil || route == nil || controller != "user" || action != "Orders" || params["id"] != "5" {
+		t.Fatalf("Resolve route = %+v %s %s %v %v", route, controller, action, params, err)
+	}
+
+	route, controller, action, _, err = Resolve(http.MethodGet, "/order/list")
+	if err != nil || route != nil || controller != "order" || action != "List" {
+		t.Fatalf("Resolve convention = %+v %s %s %v", route, controller, action, err)
+	}
+
+	route, controller, action, _, err = Resolve(http.MethodGet, "/")
+	if err != nil || route != nil || controller != "welcome" || action != "Index" {
+		t.Fatalf("Resolve / = %+v %s %s %v", route, controller, action, err)
+	}
+
+	for _, path := range []string{"/user/orders", "/user/Orders"} {
+		if _, _, _, _, err = Resolve(http.MethodGet, path); err != ErrNotFound {
+			t.Fatalf("Resolve(%s) error = %v, want ErrNotFound", path, err)
+		}
+	}
+	if !Bound("user", "Orders") || Bound("user", "Index") {
+		t.Fatal("Bound should only report actions in the route table")
+	}
+}
+
+func TestHandleInvalidPattern(t *testing.T) {
+	resetRoutes(t)
+
+	GET("/dup", "dup", "Index")
+
+	patterns := []string{"users", "/a//b", "/a/", "//", "/users/:", "/files/*", "/files/*path/more"}
+	for _, p := range patterns {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("GET(%q) should panic", p)
+				}
+			}()
+			GET(p, "bad", "Index")
+		}()
+	}
+
+	func() {
+		defer func() {
+			if v := recover(); v == nil || !strings.Contains(v.(string), "重复的路由") {
+				t.Fatalf("duplicate route panic = %v", v)
+			}
+		}()
+		GET("/dup", "dup", "Other")
+	}()
+
+	//根路由可以注册
+	GET("/", "welcome", "Index")
+	expectRoute(t, http.MethodGet, "/", "Index", map[string]string{})
+}
@@ -0,0 +1,221 @@
+package tlsConfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/solaa51/gosab/system/core/configFileMonitor"
+	slog "github.com/solaa51/gosab/system/core/log"
+)
+
+/**
+https证书管理
+通过GetCertificate提供证书 证书文件变化后自动重新加载 无需重启服务
+支持多组证书 按SNI中的域名选择 未匹配时使用第一组
+
+app.toml中配置:
+	[tls]
+	minVersion = "1.2"   #最低版本 1.0 1.1 1.2(默认) 1.3
+	cipherSuites = ["TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"] #TLS1.2及以下可用的加密套件 为空使用默认 TLS1.3不可配置
+	clientCa = "client_ca.pem" #验证客户端证书的CA 配置后客户端可提供证书 提供了无效证书的连接将被拒绝
+
+	[[tls.certs]]
+	pem = "example.com.pem"  #相对路径基于配置文件目录
+	key = "example.com.key"
+*/
+
+//tls配置
+type Config struct {
+	Certs        []Cert   `toml:"certs"`
+	MinVersion   string   `toml:"minVersion"`
+	CipherSuites []string `toml:"cipherSuites"`
+	ClientCA     string   `toml:"clientCa"`
+}
+
+//一组证书
+type Cert struct {
+	Pem string `toml:"pem"`
+	Key string `toml:"key"`
+}
+
+//当前生效的全部证书
+type certSet struct {
+	def    *tls.Certificate
+	byName map[string]*tls.Certificate
+}
+
+//证书存储 重新加载时整体替换
+type Store struct {
+	certs []Cert
+	log   *slog.NLog
+	set   atomic.Value //*certSet
+}
+
+var versions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+//加载证书并监控证书文件 dir为相对路径的基础目录
+func NewStore(certs []Cert, dir string, log *slog.NLog) (*Store, error) {
+	if len(certs) == 0 {
+		return nil, errors.New("未配置https证书")
+	}
+
+	s := &Store{log: log}
+	for _, c := range certs {
+		s.certs = append(s.certs, Cert{Pem: absPath(dir, c.Pem), Key: absPath(dir, c.Key)})
+	}
+
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+
+	for _, c := range s.certs {
+		for _, path := range []string{c.Pem, c.Key} {
+			_, err := configFileMonitor.NewFileMonitor(path, func(interface{}) {
+				s.onChange(path)
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return s, nil
+}
+
+//重新加载全部证书 任一组加载失败时保留原证书
+func (this *Store) Reload() error {
+	set := &certSet{byName: make(map[string]*tls.Certificate)}
+	for _, c := range this.certs {
+		cert, err := tls.LoadX509KeyPair(c.Pem, c.Key)
+		if err != nil {
+			return fmt.Errorf("加载证书失败 %s：%s", c.Pem, err.Error())
+		}
+
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return fmt.Errorf("解析证书失败 %s：%s", c.Pem, err.Error())
+		}
+		cert.Leaf = leaf
+
+		if set.def == nil {
+			set.def = &cert
+		}
+
+		names := leaf.DNSNames
+		if len(names) == 0 && leaf.Subject.CommonName != "" {
+			names = []string{leaf.Subject.CommonName}
+		}
+		for _, name := range names {
+			name = strings.ToLower(name)
+			if _, ok := set.byName[name]; !ok { //同一域名以先配置的为准
+				set.byName[name] = &cert
+			}
+		}
+	}
+
+	this.set.Store(set)
+	return nil
+}
+
+//证书文件变化
+func (this *Store) onChange(path string) {
+	if err := this.Reload(); err != nil {
+		//证书和私钥分别更新时 中间状态可能不匹配 等待另一个文件更新后再次加载
+		this.log.Error("证书文件变化 重新加载失败 继续使用原证书：" + err.Error())
+		return
+	}
+
+	this.log.Info("证书文件变化 已重新加载：" + path)
+}
+
+//按SNI选择证书 依次匹配完整域名、通配符域名 未匹配时使用第一组证书
+func (this *Store) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	set := this.set.Load().(*certSet)
+
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if name != "" {
+		if cert, ok := set.byName[name]; ok {
+			return cert, nil
+		}
+
+		if i := strings.Index(name, "."); i > 0 {
+			if cert, ok := set.byName["*"+name[i:]]; ok {
+				return cert, nil
+			}
+		}
+	}
+
+	return set.def, nil
+}
+
+//生成tls配置 证书由store提供 dir为clientCa相对路径的基础目录
+func New(conf Config, dir string, store *Store) (*tls.Config, error) {
+	c := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: store.GetCertificate,
+	}
+
+	if conf.MinVersion != "" {
+		v, ok := versions[conf.MinVersion]
+		if !ok {
+			return nil, errors.New("不支持的tls版本：" + conf.MinVersion)
+		}
+		c.MinVersion = v
+	}
+
+	//客户端证书可选 是否必须由各控制器的策略决定
+	if conf.ClientCA != "" {
+		pem, err := ioutil.ReadFile(absPath(dir, conf.ClientCA))
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("客户端CA证书中没有可用的证书：" + conf.ClientCA)
+		}
+
+		c.ClientCAs = pool
+		c.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	for _, name := range conf.CipherSuites {
+		id, ok := cipherSuite(name)
+		if !ok {
+			return nil, errors.New("不支持或不安全的加密套件：" + name)
+		}
+		c.CipherSuites = append(c.CipherSuites, id)
+	}
+
+	return c, nil
+}
+
+//按名称查找加密套件 只允许安全的套件
+func cipherSuite(name string) (uint16, bool) {
+	for _, s := range tls.CipherSuites() {
+		if s.Name == name {
+			return s.ID, true
+		}
+	}
+
+	return 0, false
+}
+
+func absPath(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+
+	return dir + path
+}